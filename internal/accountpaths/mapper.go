@@ -0,0 +1,125 @@
+package accountpaths
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/chill/plaidqif/internal/files"
+)
+
+// Roots of account paths which have no mapping
+const (
+	Assets      = "Assets"
+	Liabilities = "Liabilities"
+	Income      = "Income"
+	Expenses    = "Expenses"
+)
+
+// uncategorised is the account of transactions with no category
+const uncategorised = "Uncategorised"
+
+// pathMap is the on-disk representation of an account path mapping
+type pathMap struct {
+	// Accounts maps "<institution>/<account name>" to the account path of a plaid account
+	Accounts map[string]string
+	// Categories maps your categories to account paths
+	Categories map[string]string
+}
+
+// Mapper maps plaid accounts and categories to account paths for plain text accounting, such as
+// Assets:Bank:Current. Anything without a mapping gets a path generated from its name.
+type Mapper struct {
+	pathMap
+}
+
+// NewMapper assumes confDir already exists. If there is no account path mapping file,
+// the returned Mapper generates every path.
+func NewMapper(confDir, filename string) (*Mapper, error) {
+	if filename == "" {
+		filename = "accounts.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var pm pathMap
+	err := files.Unmarshal(path, "accounts", &pm)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return nil, err
+	}
+
+	return &Mapper{pathMap: pm}, nil
+}
+
+// Account returns the account path of a plaid account, defaulting to <Assets|Liabilities>:<institution>:<account>
+func (m *Mapper) Account(institution, account string, liability bool) string {
+	if p, ok := m.Accounts[institution+"/"+account]; ok {
+		return p
+	}
+
+	root := Assets
+	if liability {
+		root = Liabilities
+	}
+
+	return join(root, institution, account)
+}
+
+// Category returns the account path of a category, defaulting to Expenses:<category>, or Income:<category> for
+// income, where each QIF subcategory, separated by a colon, is another component of the path
+func (m *Mapper) Category(category string, income bool) string {
+	if p, ok := m.Categories[category]; ok {
+		return p
+	}
+
+	if category == "" {
+		category = uncategorised
+	}
+
+	root := Expenses
+	if income {
+		root = Income
+	}
+
+	return join(append([]string{root}, strings.Split(category, ":")...)...)
+}
+
+func join(components ...string) string {
+	for i, c := range components {
+		components[i] = component(c)
+	}
+
+	return strings.Join(components, ":")
+}
+
+// component makes name a valid beancount account component, which must start with a capital letter or digit,
+// and otherwise only contain letters, digits and dashes. Ledger is less strict, but happy with the same names.
+func component(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = sb.Len() != 0
+			continue
+		}
+
+		if dash {
+			sb.WriteRune('-')
+			dash = false
+		}
+
+		if sb.Len() == 0 {
+			r = unicode.ToUpper(r)
+		}
+
+		sb.WriteRune(r)
+	}
+
+	if sb.Len() == 0 {
+		return "Unknown"
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package accountpaths
+
+import "testing"
+
+func TestMapper_Account(t *testing.T) {
+	m, err := NewMapper("./", "test_accounts.json")
+	if err != nil {
+		t.Fatalf("failed to setup account path mapper: %v", err)
+	}
+
+	tests := []struct {
+		Name        string
+		Institution string
+		Account     string
+		Liability   bool
+		Expect      string
+	}{
+		{Name: "Mapped", Institution: "monzo", Account: "Current Account", Expect: "Assets:Monzo"},
+		{Name: "Asset", Institution: "monzo", Account: "Savings Pot", Expect: "Assets:Monzo:Savings-Pot"},
+		{Name: "Liability", Institution: "amex", Account: "gold card (1001)", Liability: true, Expect: "Liabilities:Amex:Gold-card-1001"},
+		{Name: "Unnamed", Institution: "amex", Account: "***", Liability: true, Expect: "Liabilities:Amex:Unknown"},
+	}
+
+	for _, tst := range tests {
+		if got := m.Account(tst.Institution, tst.Account, tst.Liability); got != tst.Expect {
+			t.Fatalf("%s: expected account path '%s', got '%s'", tst.Name, tst.Expect, got)
+		}
+	}
+}
+
+func TestMapper_Category(t *testing.T) {
+	m, err := NewMapper("./", "test_accounts.json")
+	if err != nil {
+		t.Fatalf("failed to setup account path mapper: %v", err)
+	}
+
+	tests := []struct {
+		Name     string
+		Category string
+		Income   bool
+		Expect   string
+	}{
+		{Name: "Mapped", Category: "Salary", Expect: "Income:Salary"},
+		{Name: "MappedIncome", Category: "Salary", Income: true, Expect: "Income:Salary"},
+		{Name: "Unmapped", Category: "Groceries", Expect: "Expenses:Groceries"},
+		{Name: "Subcategory", Category: "Travel:Public Transport", Expect: "Expenses:Travel:Public-Transport"},
+		{Name: "Uncategorised", Expect: "Expenses:Uncategorised"},
+		{Name: "Income", Category: "Interest", Income: true, Expect: "Income:Interest"},
+		{Name: "UncategorisedIncome", Income: true, Expect: "Income:Uncategorised"},
+	}
+
+	for _, tst := range tests {
+		if got := m.Category(tst.Category, tst.Income); got != tst.Expect {
+			t.Fatalf("%s: expected account path '%s', got '%s'", tst.Name, tst.Expect, got)
+		}
+	}
+}
+
+func TestNewMapper_NoFile(t *testing.T) {
+	m, err := NewMapper("./", "does_not_exist.json")
+	if err != nil {
+		t.Fatalf("failed to setup account path mapper: %v", err)
+	}
+
+	if got := m.Account("monzo", "Current Account", false); got != "Assets:Monzo:Current-Account" {
+		t.Fatalf("expected generated account path, got '%s'", got)
+	}
+}
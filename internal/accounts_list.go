@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"text/tabwriter"
@@ -12,7 +13,14 @@ import (
 	"github.com/chill/plaidqif/internal/institutions"
 )
 
-func (p *PlaidQIF) ListAccounts(names []string) error {
+func (p *PlaidQIF) ListAccounts(names []string, parallel int) error {
+	institutions, err := p.institutions.GetInstitutions(names)
+	if err != nil {
+		return err
+	}
+
+	fetched := p.getAllInstitutionAccounts(institutions, parallel)
+
 	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
 	defer tw.Flush()
 
@@ -20,35 +28,46 @@ func (p *PlaidQIF) ListAccounts(names []string) error {
 	fmt.Fprintln(tw, "Institution\tName\tPlaid Type\tQIF Type\tPlaid Account ID\tConsent Expires\t")
 	fmt.Fprintln(tw, "-----------\t----\t----------\t--------\t----------------\t---------------\t")
 
-	institutions, err := p.institutions.GetInstitutions(names)
-	if err != nil {
-		return err
-	}
+	var errs []error
+	for _, f := range fetched {
+		if f.err != nil {
+			errs = append(errs, f.err)
+			continue
+		}
+
+		for _, acct := range f.accounts {
+			// we'll get empty string if this is unknown, that's fine
+			qifType := plaidToQIFType[acct.Type]
 
-	for _, ins := range institutions {
-		if err := p.listInstitutionAccounts(tw, ins); err != nil {
-			return err
+			fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t",
+				f.ins.Name, acct.Name, acct.Type, qifType, acct.AccountId, f.ins.ConsentExpires.Format(time.RFC822)))
 		}
 	}
 
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to list accounts of %d of %d institutions: %w", len(errs), len(fetched), errors.Join(errs...))
+	}
+
 	return nil
 }
 
-func (p *PlaidQIF) listInstitutionAccounts(tw *tabwriter.Writer, ins institutions.Institution) error {
-	ins, accounts, err := p.getInstitutionAccounts(ins)
-	if err != nil {
-		return err
-	}
-
-	for _, acct := range accounts {
-		// we'll get empty string if this is unknown, that's fine
-		qifType := plaidToQIFType[acct.Type]
+// institutionAccounts is an institution, with its consent expiry updated, and its accounts, or the error getting them
+type institutionAccounts struct {
+	ins      institutions.Institution
+	accounts []plaid.AccountBase
+	err      error
+}
 
-		fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t",
-			ins.Name, acct.Name, acct.Type, qifType, acct.AccountId, ins.ConsentExpires.Format(time.RFC822)))
-	}
+// getAllInstitutionAccounts gets the accounts of every institution on a pool of parallel workers,
+// returned in the same order as the institutions
+func (p *PlaidQIF) getAllInstitutionAccounts(insts []institutions.Institution, parallel int) []institutionAccounts {
+	fetched := make([]institutionAccounts, len(insts))
+	inParallel(parallel, len(insts), func(i int) {
+		ins, accounts, err := p.getInstitutionAccounts(insts[i])
+		fetched[i] = institutionAccounts{ins: ins, accounts: accounts, err: err}
+	})
 
-	return nil
+	return fetched
 }
 
 func (p *PlaidQIF) getInstitutionAccounts(ins institutions.Institution) (institutions.Institution, []plaid.AccountBase, error) {
@@ -74,5 +93,13 @@ func (p *PlaidQIF) getInstitutionAccounts(ins institutions.Institution) (institu
 		return ins, nil, fmt.Errorf("failed to update consent expiry for existing institution '%s': %w", ins.Name, err)
 	}
 
+	if err := p.cache.PutAccounts(ins.Name, resp); err != nil {
+		return ins, nil, err
+	}
+
+	if err := p.store.PutAccounts(ins.Name, resp.Accounts); err != nil {
+		return ins, nil, err
+	}
+
 	return ins, resp.Accounts, nil
 }
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/files"
+)
+
+const dateFormat = "2006-01-02"
+
+// accountsFile is the last AccountsGet response of an institution
+type accountsFile struct {
+	Fetched  time.Time
+	Response plaid.AccountsGetResponse
+}
+
+// transactionsFile is every page of TransactionsGet responses for one account and date range
+type transactionsFile struct {
+	Fetched   time.Time
+	From      string
+	Until     string
+	Responses []plaid.TransactionsGetResponse
+}
+
+// Cache keeps raw plaid responses on disk, one directory per institution, so they can be converted again
+// without contacting plaid. Cache is safe for concurrent use, as accounts are downloaded in parallel.
+type Cache struct {
+	dir string
+	now func() time.Time
+	mu  sync.RWMutex
+}
+
+// New assumes confDir already exists, creating the cache directory in it if it doesn't exist yet
+func New(confDir, dirname string) (*Cache, error) {
+	if dirname == "" {
+		dirname = "cache"
+	}
+
+	dir := filepath.Join(confDir, dirname)
+	if err := files.DirExists(dir, "cache dir"); err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		dir: dir,
+		now: time.Now,
+	}, nil
+}
+
+func (c *Cache) institutionDir(institution string) (string, error) {
+	dir := filepath.Join(c.dir, institution)
+	if err := files.DirExists(dir, "institution cache dir"); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// PutAccounts replaces the cached AccountsGet response of an institution
+func (c *Cache) PutAccounts(institution string, resp plaid.AccountsGetResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir, err := c.institutionDir(institution)
+	if err != nil {
+		return err
+	}
+
+	return files.MarshalFile(filepath.Join(dir, "accounts.json"), "accounts cache", accountsFile{
+		Fetched:  c.now().UTC(),
+		Response: resp,
+	})
+}
+
+// PutTransactions caches every page of TransactionsGet responses for an account between from and until,
+// replacing any responses cached for exactly the same date range
+func (c *Cache) PutTransactions(institution, accountID string, from, until time.Time, responses []plaid.TransactionsGetResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dir, err := c.institutionDir(institution)
+	if err != nil {
+		return err
+	}
+
+	fr, to := from.Format(dateFormat), until.Format(dateFormat)
+	path := filepath.Join(dir, fmt.Sprintf("transactions_%s_%s_%s.json", accountID, fr, to))
+	return files.MarshalFile(path, "transactions cache", transactionsFile{
+		Fetched:   c.now().UTC(),
+		From:      fr,
+		Until:     to,
+		Responses: responses,
+	})
+}
+
+// Accounts returns the accounts of the cached AccountsGet response of an institution, sorted by name.
+// The error wraps os.ErrNotExist if the institution's accounts were never cached.
+func (c *Cache) Accounts(institution string) ([]plaid.AccountBase, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var af accountsFile
+	if err := files.Unmarshal(filepath.Join(c.dir, institution, "accounts.json"), "accounts cache", &af); err != nil {
+		return nil, err
+	}
+
+	accounts := af.Response.Accounts
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return accounts[i].Name < accounts[j].Name
+	})
+
+	return accounts, nil
+}
+
+// Transactions returns the cached transactions of an account dated between from and until inclusive, sorted by date.
+// Responses are replayed in the order they were fetched, with each replacing the transactions of earlier
+// responses in its date range, so transactions plaid has since removed or posted are left out.
+func (c *Cache) Transactions(institution, accountID string, from, until time.Time) ([]plaid.Transaction, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	paths, err := filepath.Glob(filepath.Join(c.dir, institution, fmt.Sprintf("transactions_%s_*.json", accountID)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions cache of account '%s': %w", accountID, err)
+	}
+
+	var cached []transactionsFile
+	for _, path := range paths {
+		var tf transactionsFile
+		if err := files.Unmarshal(path, "transactions cache", &tf); err != nil {
+			return nil, err
+		}
+
+		cached = append(cached, tf)
+	}
+
+	sort.SliceStable(cached, func(i, j int) bool {
+		return cached[i].Fetched.Before(cached[j].Fetched)
+	})
+
+	byID := make(map[string]plaid.Transaction)
+	for _, tf := range cached {
+		// plaid dates are ISO 8601, so compare lexically
+		for id, tx := range byID {
+			if tx.Date >= tf.From && tx.Date <= tf.Until {
+				delete(byID, id)
+			}
+		}
+
+		for _, resp := range tf.Responses {
+			for _, tx := range resp.Transactions {
+				if tx.AccountId == accountID {
+					byID[tx.TransactionId] = tx
+				}
+			}
+		}
+	}
+
+	fr, to := from.Format(dateFormat), until.Format(dateFormat)
+	var transactions []plaid.Transaction
+	for _, tx := range byID {
+		if tx.Date >= fr && tx.Date <= to {
+			transactions = append(transactions, tx)
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if transactions[i].Date != transactions[j].Date {
+			return transactions[i].Date < transactions[j].Date
+		}
+
+		return transactions[i].TransactionId < transactions[j].TransactionId
+	})
+
+	return transactions, nil
+}
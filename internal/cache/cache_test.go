@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(dateFormat, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func testTransaction(id, date string) plaid.Transaction {
+	return plaid.Transaction{
+		TransactionId: id,
+		AccountId:     "acct-1",
+		Name:          "Tesco",
+		Amount:        10.26,
+		Date:          date,
+	}
+}
+
+type fetch struct {
+	From, Until  string
+	Transactions []plaid.Transaction
+}
+
+func TestCache_Transactions(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Fetches []fetch
+		From    string
+		Until   string
+		Expect  []string
+	}{
+		{
+			Name: "DateRange",
+			Fetches: []fetch{{From: "2020-01-01", Until: "2020-02-29", Transactions: []plaid.Transaction{
+				testTransaction("tx-3", "2020-02-01"),
+				testTransaction("tx-2", "2020-01-05"),
+				testTransaction("tx-1", "2020-01-01"),
+			}}},
+			From: "2020-01-01", Until: "2020-01-31",
+			Expect: []string{"tx-1", "tx-2"},
+		},
+		{
+			Name: "OverlappingFetches",
+			Fetches: []fetch{
+				{From: "2020-01-01", Until: "2020-01-31", Transactions: []plaid.Transaction{
+					testTransaction("tx-1", "2020-01-01"),
+					testTransaction("pending-2", "2020-01-20"),
+				}},
+				// pending-2 has posted as tx-2 since the first fetch
+				{From: "2020-01-15", Until: "2020-02-15", Transactions: []plaid.Transaction{
+					testTransaction("tx-2", "2020-01-21"),
+					testTransaction("tx-3", "2020-02-01"),
+				}},
+			},
+			From: "2020-01-01", Until: "2020-02-29",
+			Expect: []string{"tx-1", "tx-2", "tx-3"},
+		},
+		{
+			Name: "RefetchedRange",
+			Fetches: []fetch{
+				{From: "2020-01-01", Until: "2020-01-31", Transactions: []plaid.Transaction{
+					testTransaction("tx-1", "2020-01-01"),
+					testTransaction("tx-2", "2020-01-02"),
+				}},
+				// tx-2 was removed by plaid
+				{From: "2020-01-01", Until: "2020-01-31", Transactions: []plaid.Transaction{
+					testTransaction("tx-1", "2020-01-01"),
+				}},
+			},
+			From: "2020-01-01", Until: "2020-01-31",
+			Expect: []string{"tx-1"},
+		},
+		{
+			Name: "NothingCached",
+			From: "2020-01-01", Until: "2020-01-31",
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			c, err := New(t.TempDir(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fetched := date("2021-01-01")
+			c.now = func() time.Time { return fetched }
+
+			for _, f := range tst.Fetches {
+				resp := plaid.TransactionsGetResponse{Transactions: f.Transactions, TotalTransactions: int32(len(f.Transactions))}
+				if err := c.PutTransactions("monzo", "acct-1", date(f.From), date(f.Until), []plaid.TransactionsGetResponse{resp}); err != nil {
+					t.Fatal(err)
+				}
+
+				fetched = fetched.Add(time.Hour)
+			}
+
+			txs, err := c.Transactions("monzo", "acct-1", date(tst.From), date(tst.Until))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			for _, tx := range txs {
+				ids = append(ids, tx.TransactionId)
+			}
+
+			if !reflect.DeepEqual(ids, tst.Expect) {
+				t.Fatalf("mismatch in transactions\nhave: %v\nwant: %v", ids, tst.Expect)
+			}
+		})
+	}
+}
+
+func TestCache_Accounts(t *testing.T) {
+	c, err := New(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Accounts("monzo"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist error for uncached institution, got: %v", err)
+	}
+
+	resp := plaid.AccountsGetResponse{Accounts: []plaid.AccountBase{
+		{AccountId: "acct-2", Name: "Savings", Type: plaid.ACCOUNTTYPE_DEPOSITORY},
+		{AccountId: "acct-1", Name: "Current", Type: plaid.ACCOUNTTYPE_DEPOSITORY},
+	}}
+
+	if err := c.PutAccounts("monzo", resp); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := c.Accounts("monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, acct := range accounts {
+		names = append(names, acct.Name)
+	}
+
+	if expect := []string{"Current", "Savings"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("mismatch in accounts\nhave: %v\nwant: %v", names, expect)
+	}
+}
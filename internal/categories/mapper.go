@@ -0,0 +1,92 @@
+package categories
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/chill/plaidqif/internal/files"
+)
+
+// categoryMap is the on-disk representation of a category mapping
+type categoryMap struct {
+	// Default is used for any plaid category with no mapping
+	Default string
+	// Categories maps plaid personal_finance_category primary or detailed values to your own categories
+	Categories map[string]string
+}
+
+// Mapper maps plaid personal finance categories to user defined categories,
+// keeping track of any plaid categories it could not map.
+// Mapper is not safe for concurrent use.
+type Mapper struct {
+	categoryMap
+	unmapped map[string]int
+}
+
+// NewMapper assumes confDir already exists. If there is no category mapping file,
+// the returned Mapper maps every category to an empty category.
+// The returned Mapper is not safe for concurrent use.
+func NewMapper(confDir, filename string) (*Mapper, error) {
+	if filename == "" {
+		filename = "categories.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var cm categoryMap
+	err := files.Unmarshal(path, "categories", &cm)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return nil, err
+	}
+
+	return &Mapper{
+		categoryMap: cm,
+		unmapped:    make(map[string]int),
+	}, nil
+}
+
+// Category returns the user defined category for a plaid category, preferring a mapping for the detailed
+// category over one for the primary category. If neither are mapped, the default category is returned.
+func (m *Mapper) Category(primary, detailed string) string {
+	if primary == "" && detailed == "" {
+		// plaid didn't categorise this transaction, there's nothing to add a mapping for
+		return m.Default
+	}
+
+	if c, ok := m.Categories[detailed]; ok && detailed != "" {
+		return c
+	}
+
+	if c, ok := m.Categories[primary]; ok && primary != "" {
+		return c
+	}
+
+	key := detailed
+	if key == "" {
+		key = primary
+	}
+
+	m.unmapped[key]++
+	return m.Default
+}
+
+// Unmapped returns the plaid categories that could not be mapped, with the number of times each was seen
+func (m *Mapper) Unmapped() []Unmapped {
+	unmapped := make([]Unmapped, 0, len(m.unmapped))
+	for category, count := range m.unmapped {
+		unmapped = append(unmapped, Unmapped{Category: category, Count: count})
+	}
+
+	sort.Slice(unmapped, func(i, j int) bool {
+		return unmapped[i].Category < unmapped[j].Category
+	})
+
+	return unmapped
+}
+
+type Unmapped struct {
+	Category string
+	Count    int
+}
@@ -0,0 +1,49 @@
+package categories
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapper_Category(t *testing.T) {
+	m, err := NewMapper("./", "test_categories.json")
+	if err != nil {
+		t.Fatalf("failed to setup category mapper: %v", err)
+	}
+
+	tests := []struct {
+		Name     string
+		Primary  string
+		Detailed string
+		Expect   string
+	}{
+		{Name: "Detailed", Primary: "FOOD_AND_DRINK", Detailed: "FOOD_AND_DRINK_GROCERIES", Expect: "Groceries"},
+		{Name: "PrimaryFallback", Primary: "FOOD_AND_DRINK", Detailed: "FOOD_AND_DRINK_COFFEE", Expect: "Dining"},
+		{Name: "DetailedOnly", Primary: "TRANSPORTATION", Detailed: "TRANSPORTATION_PUBLIC_TRANSIT", Expect: "Travel:Public Transport"},
+		{Name: "Unmapped", Primary: "TRAVEL", Detailed: "TRAVEL_FLIGHTS", Expect: "Uncategorised"},
+		{Name: "UnmappedAgain", Primary: "TRAVEL", Detailed: "TRAVEL_FLIGHTS", Expect: "Uncategorised"},
+		{Name: "Uncategorised", Expect: "Uncategorised"},
+	}
+
+	for _, tst := range tests {
+		if got := m.Category(tst.Primary, tst.Detailed); got != tst.Expect {
+			t.Fatalf("%s: expected category '%s', got '%s'", tst.Name, tst.Expect, got)
+		}
+	}
+
+	expect := []Unmapped{{Category: "TRAVEL_FLIGHTS", Count: 2}}
+	if got := m.Unmapped(); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("mismatch in unmapped categories\nhave: %+v\nwant: %+v", got, expect)
+	}
+}
+
+func TestNewMapper_NoFile(t *testing.T) {
+	m, err := NewMapper("./", "does_not_exist.json")
+	if err != nil {
+		t.Fatalf("failed to setup category mapper: %v", err)
+	}
+
+	if got := m.Category("FOOD_AND_DRINK", "FOOD_AND_DRINK_GROCERIES"); got != "" {
+		t.Fatalf("expected empty category, got '%s'", got)
+	}
+}
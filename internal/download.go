@@ -2,16 +2,21 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"os"
 	"regexp"
+	"strconv"
+	"text/tabwriter"
 	"time"
 
 	"github.com/plaid/plaid-go/plaid"
 
-	"github.com/chill/plaidqif/internal/files"
 	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/learned"
+	"github.com/chill/plaidqif/internal/money"
 	"github.com/chill/plaidqif/internal/qif"
+	"github.com/chill/plaidqif/internal/rules"
 )
 
 const plaidDateFormat = "2006-01-02"
@@ -20,15 +25,40 @@ var (
 	plaidToQIFType = map[plaid.AccountType]string{
 		plaid.ACCOUNTTYPE_CREDIT:     "CCard",
 		plaid.ACCOUNTTYPE_DEPOSITORY: "Bank",
+		plaid.ACCOUNTTYPE_LOAN:       "Oth L",
+		plaid.ACCOUNTTYPE_INVESTMENT: qif.InvestmentAccountType,
+		plaid.ACCOUNTTYPE_BROKERAGE:  qif.InvestmentAccountType,
 	}
 	spaceRegex = regexp.MustCompile(`\s+`)
 )
 
-func (p *PlaidQIF) DownloadTransactions(institutionNames []string, fr, to, outDir string) error {
-	if err := files.IsExistingDir(outDir); err != nil {
-		return fmt.Errorf("outdir: %w", err)
-	}
+// DownloadFailures is returned by DownloadTransactions when accounts or institutions fail, but everything else
+// was written, either because it kept going past failed downloads, or because accounts failed to be written
+type DownloadFailures struct {
+	// Failed is how many accounts, or institutions whose accounts couldn't be got, failed out of Total
+	Failed int
+	Total  int
+	err    error
+}
+
+func (f *DownloadFailures) Error() string {
+	return fmt.Sprintf("failed to download or write %d of %d accounts or institutions: %v", f.Failed, f.Total, f.err)
+}
+
+func (f *DownloadFailures) Unwrap() error {
+	return f.err
+}
 
+// Partial returns true if some accounts were downloaded, despite the failures
+func (f *DownloadFailures) Partial() bool {
+	return f.Failed < f.Total
+}
+
+// DownloadTransactions downloads and writes the transactions of every account of the institutions. If any fail to
+// download, nothing but investment transactions is written, unless keepGoing, when everything else is written.
+// Accounts which fail to be written never stop the rest. Failures after anything is written are returned as
+// DownloadFailures.
+func (p *PlaidQIF) DownloadTransactions(institutionNames []string, fr, to string, parallel int, keepGoing bool, opts OutputOptions) error {
 	from, err := time.Parse(p.dateFormat, fr)
 	if err != nil {
 		return fmt.Errorf("cannot parse date to download transactions from '%s': %w", fr, err)
@@ -39,26 +69,214 @@ func (p *PlaidQIF) DownloadTransactions(institutionNames []string, fr, to, outDi
 		return fmt.Errorf("cannot parse date to download transactions until '%s': %w", to, err)
 	}
 
+	out, err := p.newExporter(opts, from, until)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
 	institutions, err := p.institutions.GetInstitutions(institutionNames)
 	if err != nil {
 		return err
 	}
 
-	for _, ins := range institutions {
-		if err := p.downloadInstitutionTransactions(ins, from, until, outDir); err != nil {
-			return err
+	// every account is downloaded before any are written, so transfers between them can be matched
+	downloads := p.downloadAllTransactions(out, institutions, from, until, parallel)
+	return p.writeDownloads(out, institutions, downloads, keepGoing, opts)
+}
+
+// writeDownloads writes the downloaded accounts, unless any failed to download and not keepGoing, and summarises
+// them. Once anything is written, failures are returned as DownloadFailures, so that what was written is recorded.
+func (p *PlaidQIF) writeDownloads(out exporter, insts []institutions.Institution, downloads []*accountDownload, keepGoing bool, opts OutputOptions) error {
+	var downloaded []accountTransactions
+	var written []*accountDownload
+	var errs []error
+	for _, d := range downloads {
+		if d.err != nil {
+			errs = append(errs, d.err)
+			continue
+		}
+
+		if d.acct != nil && !isInvestmentAccount(*d.acct) {
+			downloaded = append(downloaded, accountTransactions{institution: d.ins.Name, acct: *d.acct, transactions: d.transactions})
+			written = append(written, d)
 		}
 	}
 
-	return nil
-}
+	if len(errs) > 0 && !keepGoing {
+		printDownloadSummary(downloads)
+		return fmt.Errorf("failed to download %d of %d accounts or institutions: %w", len(errs), len(downloads), errors.Join(errs...))
+	}
 
-func (p *PlaidQIF) downloadInstitutionTransactions(ins institutions.Institution, from, until time.Time, outDir string) error {
-	ins, accounts, err := p.getInstitutionAccounts(ins)
+	transfers, writeErrs, err := p.writeAccounts(out, downloaded, opts)
 	if err != nil {
 		return err
 	}
 
+	// accounts which fail to be written don't stop the rest, which have been written
+	for i, err := range writeErrs {
+		if err != nil {
+			written[i].err = err
+			errs = append(errs, err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	for _, d := range downloads {
+		if d.err == nil && d.count > 0 {
+			d.file = out.destination(d.ins.Name, *d.acct)
+		}
+	}
+
+	if err := p.printPendingReconciliation(insts); err != nil {
+		return err
+	}
+
+	transfers.printUnmatched()
+	p.printUnmappedCategories()
+	printDownloadSummary(downloads)
+
+	if len(errs) > 0 {
+		return &DownloadFailures{Failed: len(errs), Total: len(downloads), err: errors.Join(errs...)}
+	}
+
+	return nil
+}
+
+// accountDownload is the outcome of downloading an account's transactions, or of getting an institution's accounts
+// when acct is nil
+type accountDownload struct {
+	ins          institutions.Institution
+	acct         *plaid.AccountBase
+	transactions []plaid.Transaction
+	// count is how many transactions were downloaded, which are only kept in transactions for non-investment accounts
+	count int
+	// file is where the transactions were written, once they are
+	file string
+	// skipped is true for investment accounts which can't be written in the chosen format
+	skipped bool
+	err     error
+}
+
+// downloadAllTransactions stores the transactions of every account of the institutions, getting institutions' accounts
+// and then downloading accounts on a pool of parallel workers, so that one failing doesn't stop the rest.
+// Investment transactions are written straight away, one account at a time, as they can only be written to QIF.
+func (p *PlaidQIF) downloadAllTransactions(out exporter, insts []institutions.Institution, from, until time.Time, parallel int) []*accountDownload {
+	fetched := p.getAllInstitutionAccounts(insts, parallel)
+
+	var downloads []*accountDownload
+	for _, f := range fetched {
+		if f.err == nil {
+			f.err = checkConsent(f.ins)
+		}
+
+		if f.err != nil {
+			downloads = append(downloads, &accountDownload{ins: f.ins, err: f.err})
+			continue
+		}
+
+		for i := range f.accounts {
+			downloads = append(downloads, &accountDownload{ins: f.ins, acct: &f.accounts[i]})
+		}
+	}
+
+	inParallel(parallel, len(downloads), func(i int) {
+		d := downloads[i]
+		if d.err != nil || isInvestmentAccount(*d.acct) {
+			return
+		}
+
+		if err := p.downloadAccountTransactions(d.ins.Name, d.ins.AccessToken, *d.acct, from, until); err != nil {
+			d.err = fmt.Errorf("failed to download transactions for account '%s' from institituon '%s': %w", d.acct.Name, d.ins.Name, err)
+			return
+		}
+
+		d.transactions, d.err = p.store.Transactions(d.acct.AccountId, from, until)
+		d.count = len(d.transactions)
+	})
+
+	// holdings cover every account of an institution, so only get them once
+	holdings := make(map[string]investmentHoldings)
+	for _, d := range downloads {
+		if d.err != nil || !isInvestmentAccount(*d.acct) {
+			continue
+		}
+
+		// investment transactions can only be written to QIF, and aren't checked for earlier exports
+		qifOut, ok := unwrapExporter(out).(*qifFiles)
+		if !ok {
+			fmt.Printf("Skipping investment account '%s' from institution '%s', which can only be downloaded as QIF\n", d.acct.Name, d.ins.Name)
+			d.skipped = true
+			continue
+		}
+
+		h, ok := holdings[d.ins.Name]
+		if !ok {
+			if h, d.err = p.getInvestmentHoldings(d.ins); d.err != nil {
+				continue
+			}
+
+			holdings[d.ins.Name] = h
+		}
+
+		count, err := p.downloadInvestmentTransactions(qifOut, d.ins, h, *d.acct, from, until)
+		if err != nil {
+			d.err = fmt.Errorf("failed to download investment transactions for account '%s' from institituon '%s': %w", d.acct.Name, d.ins.Name, err)
+			continue
+		}
+
+		d.count = count
+	}
+
+	return downloads
+}
+
+// printDownloadSummary lists how many transactions were downloaded for each account, where they were written,
+// and the consent status of its institution, or why the account or institution failed
+func printDownloadSummary(downloads []*accountDownload) {
+	if len(downloads) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Download Summary:")
+	fmt.Fprintln(tw, "Institution\tAccount\tTransactions\tFile\tConsent\tResult\t")
+	fmt.Fprintln(tw, "-----------\t-------\t------------\t----\t-------\t------\t")
+
+	for _, d := range downloads {
+		account, count, result := "", "", "ok"
+		if d.acct != nil {
+			account = d.acct.Name
+			count = strconv.Itoa(d.count)
+		}
+
+		switch {
+		case d.err != nil:
+			count, result = "", d.err.Error()
+		case d.skipped:
+			count, result = "", "skipped"
+		}
+
+		fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t", d.ins.Name, account, count, d.file, consentStatus(d.ins), result))
+	}
+}
+
+// consentStatus describes when an institution's consent expires, or expired
+func consentStatus(ins institutions.Institution) string {
+	if ins.ConsentExpires.Before(time.Now()) {
+		return "expired " + ins.ConsentExpires.Format(time.RFC822)
+	}
+
+	return "expires " + ins.ConsentExpires.Format(time.RFC822)
+}
+
+// checkConsent errors if an institution's consent has expired or is about to, and warns if it expires soon
+func checkConsent(ins institutions.Institution) error {
 	if ins.ConsentExpires.Before(time.Now()) {
 		return fmt.Errorf("institution '%s' consent expired at: %s", ins.Name, ins.ConsentExpires.Format(time.RFC822))
 	} else if ins.ConsentExpires.Before(time.Now().Add(10 * time.Minute)) {
@@ -69,16 +287,10 @@ func (p *PlaidQIF) downloadInstitutionTransactions(ins institutions.Institution,
 		fmt.Printf("Institution '%s' consent expires within 1 week: %s\n", ins.Name, ins.ConsentExpires.Format(time.RFC822))
 	}
 
-	for _, acct := range accounts {
-		if err := p.downloadAccountTransactions(ins.Name, ins.AccessToken, acct, from, until, outDir); err != nil {
-			return fmt.Errorf("failed to download transactions for account '%s' from institituon '%s': %w", acct.Name, ins.Name, err)
-		}
-	}
-
 	return nil
 }
 
-func (p *PlaidQIF) downloadAccountTransactions(institution, accessToken string, acct plaid.AccountBase, from, until time.Time, outDir string) error {
+func (p *PlaidQIF) downloadAccountTransactions(institution, accessToken string, acct plaid.AccountBase, from, until time.Time) error {
 	accountIDs := []string{acct.AccountId}
 	offset := int32(0)
 	count := int32(100)
@@ -106,25 +318,13 @@ func (p *PlaidQIF) downloadAccountTransactions(institution, accessToken string,
 	offset = int32(len(resp.Transactions))
 	// but plaid's lib means we still have to update the ApiTransactionsGetRequest
 	txGet = txGet.TransactionsGetRequest(*req)
+	responses := []plaid.TransactionsGetResponse{resp}
 	if total == 0 {
-		return nil
-	}
-
-	qifType, ok := plaidToQIFType[acct.Type]
-	if !ok {
-		return fmt.Errorf("unknown plaid account type '%s'", acct.Type)
+		return p.storeAccountTransactions(institution, acct, from, until, responses)
 	}
 
-	outputPath := filepath.Join(outDir, fmt.Sprintf("%s_%s.qif", institution, acct.Name))
-	f, err := files.OpenWriter(outputPath, "qif")
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	w := qif.NewWriter(f, acct.Name, qifType, p.dateFormat)
 	for {
-		if err := appendTransactions(w, resp.Transactions); err != nil {
+		if err := p.store.PutTransactions(institution, resp.Transactions); err != nil {
 			return err
 		}
 
@@ -137,38 +337,49 @@ func (p *PlaidQIF) downloadAccountTransactions(institution, accessToken string,
 			return fmt.Errorf("failed to get transactions from plaid: %w", err)
 		}
 
+		responses = append(responses, resp)
 		// again, req already contains a pointer to offset, so updating this updates the request for next time
 		offset += int32(len(resp.Transactions))
 		// but plaid's lib means we still have to update the ApiTransactionsGetRequest
 		txGet = txGet.TransactionsGetRequest(*req)
 	}
 
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("failed to close qif file '%s': %w", outputPath, err)
-	}
-
-	return nil
+	return p.storeAccountTransactions(institution, acct, from, until, responses)
 }
 
-func appendTransactions(w *qif.Writer, transactions []plaid.Transaction) error {
-	if len(transactions) == 0 {
-		return nil
+// storeAccountTransactions caches every response for an account's transactions between from and until,
+// and removes stored transactions plaid no longer returns over those dates
+func (p *PlaidQIF) storeAccountTransactions(institution string, acct plaid.AccountBase, from, until time.Time, responses []plaid.TransactionsGetResponse) error {
+	if err := p.cache.PutTransactions(institution, acct.AccountId, from, until, responses); err != nil {
+		return err
 	}
 
-	qifTransactions, err := convertTransactions(transactions)
-	if err != nil {
-		return err
+	var ids []string
+	for _, resp := range responses {
+		for _, tx := range resp.Transactions {
+			ids = append(ids, tx.TransactionId)
+		}
 	}
 
-	if err := w.WriteTransactions(qifTransactions); err != nil {
-		return fmt.Errorf("failed to write transactions to qif writer: %w", err)
+	return p.store.RemoveMissing(acct.AccountId, from, until, ids)
+}
+
+// appendTransactions writes the transactions of an account, even if there are none, as bank statements are written
+// for every account
+func (p *PlaidQIF) appendTransactions(out exporter, transfers *transferMatcher, institution string, acct plaid.AccountBase, transactions []plaid.Transaction) error {
+	converted, err := p.convertTransactions(acct, transfers, transactions)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return out.writeTransactions(institution, acct, converted)
 }
 
-func convertTransactions(transactions []plaid.Transaction) ([]qif.Transaction, error) {
-	txs := make([]qif.Transaction, 0, len(transactions))
+// convertTransactions converts plaid transactions to QIF, categorising transactions matched by transfers
+// as transfers to the other account
+func (p *PlaidQIF) convertTransactions(acct plaid.AccountBase, transfers *transferMatcher, transactions []plaid.Transaction) ([]transaction, error) {
+	txs := make([]transaction, 0, len(transactions))
+	var observations []learned.Observation
 	for _, tx := range transactions {
 		payee := tx.Name
 		if p := tx.PaymentMeta.Payee.Get(); p != nil {
@@ -180,18 +391,206 @@ func convertTransactions(transactions []plaid.Transaction) ([]qif.Transaction, e
 			return nil, fmt.Errorf("failed to parse transaction date for payee '%s' with date string '%s: %w", payee, tx.Date, err)
 		}
 
+		original, amount, err := p.transactionAmount(tx, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert transaction amount for payee '%s': %w", payee, err)
+		}
+
+		rw, _, byRule, err := p.rewriteTransaction(acct, tx, payee, original, amount)
+		if err != nil {
+			return nil, err
+		}
+
+		if byRule {
+			// categories set by rules are observed, so they can be learned
+			observations = append(observations, learned.Observation{
+				Key:      tx.TransactionId,
+				Source:   learned.SourceRule,
+				Payee:    learned.NormalizePayee(rw.Payee),
+				Category: rw.Category,
+				Amount:   amount,
+			})
+		}
+
+		if amount != original {
+			rw.Memo = originalMemo(rw.Memo, original)
+		}
+
 		qiftx := qif.Transaction{
-			Date:   date,
-			Payee:  payee,
-			Amount: float64(tx.Amount),
+			Date:     date,
+			Payee:    rw.Payee,
+			Memo:     rw.Memo,
+			Amount:   amount,
+			Category: rw.Category,
+			Number:   transactionNumber(tx),
+			Cleared:  qif.Reconciled,
+			Address:  locationAddress(tx.Location),
 		}
 
 		if tx.Pending {
-			qiftx.Memo = "Pending"
+			qiftx.Memo = pendingMemo(rw.Memo)
+			qiftx.Cleared = qif.Cleared
 		}
 
-		txs = append(txs, qiftx)
+		if other, ok := transfers.match(tx.TransactionId); ok {
+			// writers name the other account as they name accounts, this is only a fallback
+			qiftx.Category = "[" + other.acct.Name + "]"
+			txs = append(txs, transaction{Transaction: qiftx, source: tx, transfer: &other, original: original})
+			continue
+		}
+
+		// split rules which don't fit a transaction, such as a fixed split larger than a refund, leave it unsplit
+		if qiftx.Splits, err = p.splitter.Split(acct.Name, qiftx); err != nil {
+			fmt.Printf("Not splitting transaction '%s' on %s in account '%s': %v\n", tx.TransactionId, tx.Date, acct.Name, err)
+		}
+
+		txs = append(txs, transaction{Transaction: qiftx, source: tx, original: original})
+	}
+
+	if err := p.store.PutObservations(observations); err != nil {
+		return nil, err
 	}
 
 	return txs, nil
 }
+
+// transactionAmount returns the amount of a transaction in its own currency, and converted to the reporting currency
+func (p *PlaidQIF) transactionAmount(tx plaid.Transaction, date time.Time) (original, amount money.Amount, err error) {
+	original, err = money.FromFloat32(tx.Amount, currencyCode(tx.IsoCurrencyCode, tx.UnofficialCurrencyCode))
+	if err != nil {
+		return original, amount, err
+	}
+
+	amount, err = p.fx.Convert(original, date)
+	if err != nil {
+		return original, amount, fmt.Errorf("failed to convert to reporting currency: %w", err)
+	}
+
+	return original, amount, nil
+}
+
+// rewriteTransaction applies the payee rules to a transaction, and returns the names of the rules applied, and whether
+// they set its category. Otherwise, a category learned with enough confidence is used, or plaid's category is mapped,
+// and a less confident learned category is suggested in the memo. Rules match plaid's original amount, and learned
+// categories the amount in the reporting currency.
+func (p *PlaidQIF) rewriteTransaction(acct plaid.AccountBase, tx plaid.Transaction, payee string, original, amount money.Amount) (rules.Rewrite, []string, bool, error) {
+	var merchant string
+	if m := tx.MerchantName.Get(); m != nil {
+		merchant = *m
+	}
+
+	rw, applied := p.rules.Apply(rules.Transaction{
+		Account:  acct.Name,
+		Name:     tx.Name,
+		Merchant: merchant,
+		Amount:   original,
+	}, rules.Rewrite{Payee: payee})
+
+	if rw.Category != "" {
+		return rw, applied, true, nil
+	}
+
+	observations, err := p.store.Observations(learned.NormalizePayee(rw.Payee))
+	if err != nil {
+		return rw, applied, false, err
+	}
+
+	suggestion := learned.Suggest(observations, amount)
+	if suggestion.Category != "" && suggestion.Confidence >= p.learning.Apply {
+		rw.Category = suggestion.Category
+		return rw, applied, false, nil
+	}
+
+	var primary, detailed string
+	if pfc := tx.PersonalFinanceCategory.Get(); pfc != nil {
+		primary, detailed = pfc.Primary, pfc.Detailed
+	}
+
+	rw.Category = p.categories.Category(primary, detailed)
+	if suggestion.Category != "" && suggestion.Category != rw.Category && suggestion.Confidence >= p.learning.Suggest {
+		if rw.Memo == "" {
+			rw.Memo = suggestion.Memo()
+		} else {
+			rw.Memo += "; " + suggestion.Memo()
+		}
+	}
+
+	return rw, applied, false, nil
+}
+
+// pendingMemo marks the memo of a pending transaction as pending
+func pendingMemo(memo string) string {
+	if memo == "" {
+		return "Pending"
+	}
+
+	return "Pending: " + memo
+}
+
+// originalMemo keeps the amount of a transaction converted to the reporting currency in its memo,
+// as QIF has no way to give a transaction's currency
+func originalMemo(memo string, original money.Amount) string {
+	note := fmt.Sprintf("Original: %s %s", original, original.Currency)
+	if memo == "" {
+		return note
+	}
+
+	return memo + "; " + note
+}
+
+// currencyCode returns the ISO 4217 currency code plaid gave a transaction or balance, or its unofficial one if not
+func currencyCode(iso, unofficial plaid.NullableString) string {
+	if c := iso.Get(); c != nil {
+		return *c
+	}
+
+	if c := unofficial.Get(); c != nil {
+		return *c
+	}
+
+	return ""
+}
+
+// transactionNumber returns the check number of a transaction, falling back to its payment reference number
+func transactionNumber(tx plaid.Transaction) string {
+	if n := tx.CheckNumber.Get(); n != nil && *n != "" {
+		return *n
+	}
+
+	if n := tx.PaymentMeta.ReferenceNumber.Get(); n != nil {
+		return *n
+	}
+
+	return ""
+}
+
+// locationAddress returns the non-empty parts of a plaid location, one per address line
+func locationAddress(loc plaid.Location) []string {
+	var lines []string
+	for _, part := range []plaid.NullableString{loc.Address, loc.City, loc.Region, loc.PostalCode, loc.Country} {
+		if v := part.Get(); v != nil && *v != "" {
+			lines = append(lines, *v)
+		}
+	}
+
+	return lines
+}
+
+// printUnmappedCategories lists plaid categories seen which have no mapping in the confdir, so they can be added
+func (p *PlaidQIF) printUnmappedCategories() {
+	unmapped := p.categories.Unmapped()
+	if len(unmapped) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Unmapped Categories:")
+	fmt.Fprintln(tw, "Plaid Category\tTransactions\t")
+	fmt.Fprintln(tw, "--------------\t------------\t")
+
+	for _, u := range unmapped {
+		fmt.Fprintln(tw, fmt.Sprintf("%s\t%d\t", u.Category, u.Count))
+	}
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+)
+
+// testPlaidQIF returns a PlaidQIF with an empty confdir, which can't contact plaid
+func testPlaidQIF(t *testing.T) *PlaidQIF {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := WriteCredentials(dir, Credentials{ClientID: "client", Secret: "secret", UserID: "user"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := PlaidQif(dir, "sandbox", "plaidqif", "GB", "02/01/2006", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		p.store.Close()
+	})
+
+	return p
+}
+
+// fakeExporter counts the transactions written to each account, failing to write the account named fail
+type fakeExporter struct {
+	fail    string
+	written map[string]int
+}
+
+func (f *fakeExporter) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if acct.Name == f.fail {
+		return errors.New("disk full")
+	}
+
+	f.written[acct.Name] += len(transactions)
+	return nil
+}
+
+func (f *fakeExporter) destination(institution string, acct plaid.AccountBase) string {
+	return institution + "_" + acct.Name + ".qif"
+}
+
+func (f *fakeExporter) Close() error {
+	return nil
+}
+
+func testAccountDownload(ins institutions.Institution, name string) *accountDownload {
+	acct := plaid.AccountBase{AccountId: name, Name: name, Type: plaid.ACCOUNTTYPE_DEPOSITORY}
+	tx := testTransfer(name+"-tx", name, "2020-01-02", 10, "FOOD_AND_DRINK")
+	return &accountDownload{ins: ins, acct: &acct, transactions: []plaid.Transaction{tx}, count: 1}
+}
+
+func TestWriteDownloads(t *testing.T) {
+	bank := institutions.Institution{Name: "bank"}
+	other := institutions.Institution{Name: "other"}
+
+	tests := []struct {
+		Name           string
+		KeepGoing      bool
+		DownloadFailed bool
+		Fail           string
+		// Failures is nil if a plain error is expected, rather than DownloadFailures
+		Failures *DownloadFailures
+		Written  map[string]int
+		Files    map[string]string
+	}{
+		{
+			Name:    "Success",
+			Written: map[string]int{"current": 1, "savings": 1},
+			Files:   map[string]string{"current": "bank_current.qif", "savings": "bank_savings.qif"},
+		},
+		{
+			Name:           "DownloadFailure",
+			DownloadFailed: true,
+			Written:        map[string]int{},
+			Files:          map[string]string{},
+		},
+		{
+			Name:           "KeepGoing",
+			KeepGoing:      true,
+			DownloadFailed: true,
+			Failures:       &DownloadFailures{Failed: 1, Total: 3},
+			Written:        map[string]int{"current": 1, "savings": 1},
+			Files:          map[string]string{"current": "bank_current.qif", "savings": "bank_savings.qif"},
+		},
+		{
+			Name:     "WriteFailure",
+			Fail:     "savings",
+			Failures: &DownloadFailures{Failed: 1, Total: 2},
+			Written:  map[string]int{"current": 1},
+			Files:    map[string]string{"current": "bank_current.qif"},
+		},
+		{
+			Name:           "KeepGoingWriteFailure",
+			KeepGoing:      true,
+			DownloadFailed: true,
+			Fail:           "savings",
+			Failures:       &DownloadFailures{Failed: 2, Total: 3},
+			Written:        map[string]int{"current": 1},
+			Files:          map[string]string{"current": "bank_current.qif"},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			p := testPlaidQIF(t)
+
+			downloads := []*accountDownload{testAccountDownload(bank, "current"), testAccountDownload(bank, "savings")}
+			if tst.DownloadFailed {
+				downloads = append(downloads, &accountDownload{ins: other, err: errors.New("consent expired")})
+			}
+
+			out := &fakeExporter{fail: tst.Fail, written: make(map[string]int)}
+			err := p.writeDownloads(out, []institutions.Institution{bank, other}, downloads, tst.KeepGoing,
+				OutputOptions{IncludeExported: true, TransferDays: -1})
+
+			var failures *DownloadFailures
+			switch {
+			case !tst.DownloadFailed && tst.Fail == "":
+				if err != nil {
+					t.Fatal(err)
+				}
+			case tst.Failures == nil:
+				if err == nil || errors.As(err, &failures) {
+					t.Fatalf("expected plain error, got: %v", err)
+				}
+			default:
+				if !errors.As(err, &failures) {
+					t.Fatalf("expected download failures, got: %v", err)
+				}
+
+				if failures.Failed != tst.Failures.Failed || failures.Total != tst.Failures.Total {
+					t.Fatalf("mismatch in failures\nhave: %d of %d\nwant: %d of %d", failures.Failed, failures.Total,
+						tst.Failures.Failed, tst.Failures.Total)
+				}
+			}
+
+			if !reflect.DeepEqual(out.written, tst.Written) {
+				t.Fatalf("mismatch in transactions written\nhave: %v\nwant: %v", out.written, tst.Written)
+			}
+
+			files := make(map[string]string)
+			for _, d := range downloads {
+				if d.file != "" {
+					files[d.acct.Name] = d.file
+				}
+
+				if d.acct != nil && d.acct.Name == tst.Fail && d.err == nil {
+					t.Fatalf("expected account '%s' which failed to be written to have an error", d.acct.Name)
+				}
+			}
+
+			if !reflect.DeepEqual(files, tst.Files) {
+				t.Fatalf("mismatch in files written\nhave: %v\nwant: %v", files, tst.Files)
+			}
+		})
+	}
+}
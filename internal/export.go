@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// ExportTransactions writes transactions from the local store, or from cached plaid responses if fromCache is set,
+// without contacting plaid, so exports can be regenerated in any format for any date range.
+// Only the named accounts are exported, or all of them if none are named.
+func (p *PlaidQIF) ExportTransactions(institutionNames []string, fr, to string, accountNames []string, fromCache bool, opts OutputOptions) error {
+	from, err := time.Parse(p.dateFormat, fr)
+	if err != nil {
+		return fmt.Errorf("cannot parse date to export transactions from '%s': %w", fr, err)
+	}
+
+	until, err := time.Parse(p.dateFormat, to)
+	if err != nil {
+		return fmt.Errorf("cannot parse date to export transactions until '%s': %w", to, err)
+	}
+
+	institutions, err := p.institutions.GetInstitutions(institutionNames)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(accountNames))
+	for _, name := range accountNames {
+		wanted[name] = true
+	}
+
+	out, err := p.newExporter(opts, from, until)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	exported := make(map[string]bool, len(accountNames))
+	var stored []accountTransactions
+	for _, ins := range institutions {
+		accounts, err := p.exportAccounts(ins.Name, fromCache)
+		if err != nil {
+			return err
+		}
+
+		for _, acct := range accounts {
+			if len(wanted) != 0 && !wanted[acct.Name] {
+				continue
+			}
+
+			exported[acct.Name] = true
+
+			// investment transactions aren't kept in the store, they can only be downloaded
+			if isInvestmentAccount(acct) {
+				fmt.Printf("Skipping investment account '%s' from institution '%s', which can only be downloaded\n", acct.Name, ins.Name)
+				continue
+			}
+
+			var transactions []plaid.Transaction
+			if fromCache {
+				// cached transactions are converted just as they were when they were downloaded
+				transactions, err = p.cache.Transactions(ins.Name, acct.AccountId, from, until)
+			} else {
+				transactions, err = p.store.Transactions(acct.AccountId, from, until)
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to export transactions for account '%s' from institution '%s': %w", acct.Name, ins.Name, err)
+			}
+
+			stored = append(stored, accountTransactions{institution: ins.Name, acct: acct, transactions: transactions})
+		}
+	}
+
+	for _, name := range accountNames {
+		if !exported[name] {
+			return fmt.Errorf("no account '%s' to export, download it first", name)
+		}
+	}
+
+	transfers, errs, err := p.writeAccounts(out, stored, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	transfers.printUnmatched()
+	p.printUnmappedCategories()
+	return nil
+}
+
+func (p *PlaidQIF) exportAccounts(institution string, fromCache bool) ([]plaid.AccountBase, error) {
+	if !fromCache {
+		return p.store.Accounts(institution)
+	}
+
+	accounts, err := p.cache.Accounts(institution)
+	if errors.Is(err, os.ErrNotExist) {
+		// nothing has been downloaded from this institution yet
+		return nil, nil
+	}
+
+	return accounts, err
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+)
+
+// exportedFilter records the transactions written by an exporter with their institution, so that transactions
+// written by an earlier run are skipped, or written again and counted if include is set.
+// exportedFilter is not safe for concurrent use.
+type exportedFilter struct {
+	exporter
+	institutions *institutions.InstitutionManager
+	include      bool
+	// skipped counts the transactions skipped by the file or book they were first written to
+	skipped  map[string]int
+	order    []string
+	included int
+}
+
+func newExportedFilter(out exporter, institutions *institutions.InstitutionManager, include bool) *exportedFilter {
+	return &exportedFilter{
+		exporter:     out,
+		institutions: institutions,
+		include:      include,
+		skipped:      make(map[string]int),
+	}
+}
+
+func (e *exportedFilter) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	unexported := make([]transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		path, ok := e.institutions.ExportedTo(institution, tx.source.TransactionId)
+		switch {
+		case !ok:
+			unexported = append(unexported, tx)
+		case e.include:
+			e.included++
+		default:
+			if _, ok := e.skipped[path]; !ok {
+				e.order = append(e.order, path)
+			}
+
+			e.skipped[path]++
+		}
+	}
+
+	write := unexported
+	if e.include {
+		write = transactions
+	}
+
+	if err := e.exporter.writeTransactions(institution, acct, write); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(unexported))
+	for _, tx := range unexported {
+		ids = append(ids, tx.source.TransactionId)
+	}
+
+	if _, err := e.institutions.AddExported(institution, e.exporter.destination(institution, acct), ids); err != nil {
+		return fmt.Errorf("failed to record exported transactions for institution '%s': %w", institution, err)
+	}
+
+	return nil
+}
+
+// Close reports the transactions skipped or written again, and closes the exporter
+func (e *exportedFilter) Close() error {
+	for _, path := range e.order {
+		fmt.Printf("Skipped %d transactions already exported to '%s', use --include-exported to write them again\n", e.skipped[path], path)
+	}
+
+	if e.included != 0 {
+		fmt.Printf("Wrote %d transactions again which were already exported\n", e.included)
+	}
+
+	e.skipped = make(map[string]int)
+	e.order = nil
+	e.included = 0
+	return e.exporter.Close()
+}
+
+// unwrapExporter returns the exporter of settled transactions underneath any exportedFilter or pendingSplitter
+func unwrapExporter(out exporter) exporter {
+	for {
+		switch e := out.(type) {
+		case *exportedFilter:
+			out = e.exporter
+		case *pendingSplitter:
+			out = e.settled
+		default:
+			return out
+		}
+	}
+}
@@ -2,6 +2,7 @@ package files
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 )
@@ -14,7 +15,8 @@ func DirExists(path, kind string) error {
 		return nil
 	}
 
-	if !os.IsNotExist(err) {
+	// os.IsNotExist doesn't unwrap errors
+	if !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("%s: %w", kind, err)
 	}
 
@@ -0,0 +1,196 @@
+package fx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Config is the currency amounts are reported in, and where to find the rates to convert them
+type Config struct {
+	// Currency is the ISO 4217 reporting currency. If empty, amounts are left in their own currencies.
+	Currency string
+	// Rates is the path of a CSV or ECB XML file of exchange rates, relative to the confdir unless absolute
+	Rates string
+}
+
+// rate is the price of one unit of a currency in another, from Date until the next rate
+type rate struct {
+	Date time.Time
+	Rate float64
+}
+
+type pair struct {
+	From string
+	To   string
+}
+
+// Converter converts amounts to the reporting currency, using the latest rate on or before the date of each amount
+type Converter struct {
+	currency   string
+	rates      map[pair][]rate
+	currencies []string
+}
+
+// NewConverter assumes confDir already exists. If there is no fx config file, or it has no reporting currency,
+// the returned Converter leaves amounts in their own currencies.
+func NewConverter(confDir, filename string) (*Converter, error) {
+	if filename == "" {
+		filename = "fx.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var c Config
+	err := files.Unmarshal(path, "fx", &c)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return nil, err
+	}
+
+	cv := &Converter{currency: strings.ToUpper(c.Currency), rates: make(map[pair][]rate)}
+	if cv.currency == "" {
+		return cv, nil
+	}
+
+	if c.Rates == "" {
+		return nil, fmt.Errorf("fx file '%s' has a reporting currency but no rates file", path)
+	}
+
+	ratesPath := c.Rates
+	if !filepath.IsAbs(ratesPath) {
+		ratesPath = filepath.Join(confDir, ratesPath)
+	}
+
+	if err := cv.load(ratesPath); err != nil {
+		return nil, err
+	}
+
+	return cv, nil
+}
+
+// Currency returns the reporting currency, or the empty string if amounts are left in their own currencies
+func (c *Converter) Currency() string {
+	return c.currency
+}
+
+func (c *Converter) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open fx rates file '%s' for reading: %w", path, err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		err = readECB(f, c.add)
+	} else {
+		err = readCSV(f, c.add)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read fx rates file '%s': %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for p, rates := range c.rates {
+		sort.Slice(rates, func(i, j int) bool { return rates[i].Date.Before(rates[j].Date) })
+
+		for _, currency := range []string{p.From, p.To} {
+			if !seen[currency] {
+				seen[currency] = true
+				c.currencies = append(c.currencies, currency)
+			}
+		}
+	}
+	sort.Strings(c.currencies)
+
+	return nil
+}
+
+// add records that one unit of from cost r of to on date
+func (c *Converter) add(date time.Time, from, to string, r float64) error {
+	if r <= 0 {
+		return fmt.Errorf("rate of %s to %s on %s is not positive", from, to, date.Format("2006-01-02"))
+	}
+
+	p := pair{From: strings.ToUpper(from), To: strings.ToUpper(to)}
+	c.rates[p] = append(c.rates[p], rate{Date: date, Rate: r})
+	return nil
+}
+
+// Convert returns a in the reporting currency, at the rate on date. Amounts already in the reporting currency,
+// or in no currency, are returned unchanged.
+func (c *Converter) Convert(a money.Amount, date time.Time) (money.Amount, error) {
+	from := strings.ToUpper(a.Currency)
+	if c.currency == "" || from == "" || from == c.currency {
+		return a, nil
+	}
+
+	r, ok := c.rate(from, c.currency, date)
+	if !ok {
+		return money.Amount{}, fmt.Errorf("no fx rate from %s to %s on or before %s", from, c.currency, date.Format("2006-01-02"))
+	}
+
+	converted, err := money.FromFloat64(a.Float64()*r, c.currency)
+	if err != nil {
+		return money.Amount{}, fmt.Errorf("failed to convert %s %s to %s: %w", a, from, c.currency, err)
+	}
+
+	return converted, nil
+}
+
+// rate finds the rate from one currency to another directly, inverted, or across a third currency,
+// such as the euro for ECB rates
+func (c *Converter) rate(from, to string, date time.Time) (float64, bool) {
+	if r, ok := c.directRate(from, to, date); ok {
+		return r, true
+	}
+
+	for _, via := range c.currencies {
+		if via == from || via == to {
+			continue
+		}
+
+		r1, ok := c.directRate(from, via, date)
+		if !ok {
+			continue
+		}
+
+		r2, ok := c.directRate(via, to, date)
+		if !ok {
+			continue
+		}
+
+		return r1 * r2, true
+	}
+
+	return 0, false
+}
+
+func (c *Converter) directRate(from, to string, date time.Time) (float64, bool) {
+	if r, ok := latest(c.rates[pair{From: from, To: to}], date); ok {
+		return r, true
+	}
+
+	if r, ok := latest(c.rates[pair{From: to, To: from}], date); ok {
+		return 1 / r, true
+	}
+
+	return 0, false
+}
+
+// latest returns the last of the rates, sorted by date, on or before date
+func latest(rates []rate, date time.Time) (float64, bool) {
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].Date.After(date) })
+	if i == 0 {
+		return 0, false
+	}
+
+	return rates[i-1].Rate, true
+}
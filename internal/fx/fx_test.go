@@ -0,0 +1,134 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(rateDateFormat, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Filename string
+		Amount   money.Amount
+		Date     string
+		Expect   money.Amount
+		Err      string
+	}{
+		{
+			Name:     "CSV",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("10", "EUR"),
+			Date:     "2024-01-02",
+			Expect:   money.MustParse("8.60", "GBP"),
+		},
+		{
+			Name:     "CSVLatestRateBefore",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("10", "EUR"),
+			Date:     "2024-01-06",
+			Expect:   money.MustParse("8.70", "GBP"),
+		},
+		{
+			Name:     "CSVInverted",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("-12.50", "USD"),
+			Date:     "2024-01-02",
+			Expect:   money.MustParse("-10", "GBP"),
+		},
+		{
+			Name:     "CSVNoRateYet",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("10", "EUR"),
+			Date:     "2024-01-01",
+			Err:      "no fx rate from EUR to GBP",
+		},
+		{
+			Name:     "CSVUnknownCurrency",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("10", "JPY"),
+			Date:     "2024-01-02",
+			Err:      "no fx rate from JPY to GBP",
+		},
+		{
+			Name:     "ReportingCurrency",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("10.26", "GBP"),
+			Date:     "2024-01-01",
+			Expect:   money.MustParse("10.26", "GBP"),
+		},
+		{
+			Name:     "NoCurrency",
+			Filename: "test_fx.json",
+			Amount:   money.MustParse("10.26", ""),
+			Date:     "2024-01-01",
+			Expect:   money.MustParse("10.26", ""),
+		},
+		{
+			Name:     "ECB",
+			Filename: "test_fx_ecb.json",
+			Amount:   money.MustParse("10", "EUR"),
+			Date:     "2024-01-02",
+			Expect:   money.MustParse("8.66", "GBP"),
+		},
+		{
+			Name:     "ECBAcrossEuro",
+			Filename: "test_fx_ecb.json",
+			Amount:   money.MustParse("10", "USD"),
+			Date:     "2024-01-03",
+			Expect:   money.MustParse("7.90", "GBP"),
+		},
+		{
+			Name:     "NoConfig",
+			Filename: "does_not_exist.json",
+			Amount:   money.MustParse("10", "EUR"),
+			Date:     "2024-01-02",
+			Expect:   money.MustParse("10", "EUR"),
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			c, err := NewConverter(".", tst.Filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.Convert(tst.Amount, date(tst.Date))
+			if tst.Err != "" {
+				if err == nil || !strings.Contains(err.Error(), tst.Err) {
+					t.Fatalf("expected error containing '%s', got: %v", tst.Err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tst.Expect {
+				t.Fatalf("mismatch in converted amount\nhave: %s %s\nwant: %s %s", got, got.Currency, tst.Expect, tst.Expect.Currency)
+			}
+		})
+	}
+}
+
+func TestNewConverterNoRates(t *testing.T) {
+	_, err := NewConverter(".", "test_fx_no_rates.json")
+	if err == nil || !strings.Contains(err.Error(), "no rates file") {
+		t.Fatalf("expected missing rates file error, got: %v", err)
+	}
+}
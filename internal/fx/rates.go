@@ -0,0 +1,92 @@
+package fx
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rateDateFormat = "2006-01-02"
+
+type addFunc func(date time.Time, from, to string, rate float64) error
+
+// readCSV reads rates with the columns Date, From, To and Rate, where one unit of From costs Rate of To,
+// and dates are YYYY-MM-DD. A header row is skipped.
+func readCSV(r io.Reader, add addFunc) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+
+		date, err := time.Parse(rateDateFormat, record[0])
+		if err != nil {
+			return fmt.Errorf("invalid date on line %d: %w", line, err)
+		}
+
+		rate, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return fmt.Errorf("invalid rate on line %d: %w", line, err)
+		}
+
+		if err := add(date, record[1], record[2], rate); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// ecbEnvelope is the euro foreign exchange reference rates published by the European Central Bank, daily
+// or historically, as in https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// readECB reads ECB reference rates, which are the price of one euro in each currency
+func readECB(r io.Reader, add addFunc) error {
+	var env ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&env); err != nil {
+		return err
+	}
+
+	for _, day := range env.Days {
+		date, err := time.Parse(rateDateFormat, day.Time)
+		if err != nil {
+			return fmt.Errorf("invalid date: %w", err)
+		}
+
+		for _, cr := range day.Rates {
+			rate, err := strconv.ParseFloat(cr.Rate, 64)
+			if err != nil {
+				return fmt.Errorf("invalid rate of %s on %s: %w", cr.Currency, day.Time, err)
+			}
+
+			if err := add(date, "EUR", cr.Currency, rate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,356 @@
+package gnucash
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+
+	// registers the pure go "sqlite" database/sql driver, so no cgo is needed
+	_ "modernc.org/sqlite"
+)
+
+// GnuCash SQL schema: https://wiki.gnucash.org/wiki/SQL
+
+// IDSlot is the name of the slot holding each transaction's ID, so transactions are only added once
+const IDSlot = "plaid-transaction-id"
+
+// slot types, from GnuCash's KvpValue::Type
+const (
+	slotTypeString = 4
+	slotTypeGDate  = 10
+)
+
+// dateTimeFormat is how GnuCash stores timestamps in SQLite, always in UTC
+const dateTimeFormat = "2006-01-02 15:04:05"
+
+// Transaction is a balanced transaction: the amounts of its splits must sum to zero
+type Transaction struct {
+	// ID is stored in the IDSlot of the transaction
+	ID          string
+	Date        time.Time
+	Description string
+	Num         string
+	Notes       string
+	Splits      []Split
+}
+
+// Split moves Amount into an account, so amounts debiting an account are positive.
+// The account must be in the currency of Amount, unless the split has a Quantity.
+type Split struct {
+	AccountGUID string
+	Amount      money.Amount
+	// Quantity, if set, is the amount in the account's own currency, when that isn't the transaction's currency
+	Quantity *money.Amount
+	Memo     string
+	Cleared  bool
+}
+
+type commodity struct {
+	guid     string
+	fraction int64
+}
+
+type account struct {
+	name          string
+	commodityGUID string
+}
+
+// Book adds transactions to a GnuCash SQLite book within one database transaction, which is committed on Close.
+// Book is not safe for concurrent use.
+type Book struct {
+	path       string
+	db         *sql.DB
+	tx         *sql.Tx
+	ids        map[string]bool
+	currencies map[string]commodity
+	accounts   map[string]account
+	now        func() time.Time
+	newGUID    func() (string, error)
+}
+
+// Open opens an existing GnuCash SQLite book, which must not be open in GnuCash
+func Open(path string) (*Book, error) {
+	// sqlite would otherwise create an empty database
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to stat gnucash book '%s': %w", path, err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gnucash book '%s': %w", path, err)
+	}
+
+	b := &Book{
+		path:       path,
+		db:         db,
+		ids:        make(map[string]bool),
+		currencies: make(map[string]commodity),
+		accounts:   make(map[string]account),
+		now:        time.Now,
+		newGUID:    newGUID,
+	}
+
+	if err := b.begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Book) begin() error {
+	// gnucash locks books it has open by adding a row to gnclock
+	var locks int
+	if err := b.db.QueryRow("SELECT COUNT(*) FROM gnclock").Scan(&locks); err != nil {
+		return fmt.Errorf("failed to check lock of gnucash book '%s', is it a gnucash sqlite book? %w", b.path, err)
+	}
+
+	if locks != 0 {
+		return fmt.Errorf("gnucash book '%s' is open in gnucash, close it first", b.path)
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction on gnucash book '%s': %w", b.path, err)
+	}
+
+	b.tx = tx
+
+	rows, err := tx.Query("SELECT string_val FROM slots WHERE name = ?", IDSlot)
+	if err != nil {
+		return fmt.Errorf("failed to read transaction ids from gnucash book '%s': %w", b.path, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id sql.NullString
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to read transaction ids from gnucash book '%s': %w", b.path, err)
+		}
+
+		b.ids[id.String] = true
+	}
+
+	return rows.Err()
+}
+
+// HasTransaction returns true if a transaction with the ID is already in the book
+func (b *Book) HasTransaction(id string) bool {
+	return b.ids[id]
+}
+
+// AddTransaction adds a transaction to the book, which is only saved on Close
+func (b *Book) AddTransaction(t Transaction) error {
+	if len(t.Splits) == 0 {
+		return fmt.Errorf("transaction '%s' has no splits", t.ID)
+	}
+
+	currency := t.Splits[0].Amount.Currency
+	cur, err := b.currency(currency)
+	if err != nil {
+		return err
+	}
+
+	sum := money.New(0, currency)
+	for _, s := range t.Splits {
+		if sum, err = sum.Add(s.Amount); err != nil {
+			return fmt.Errorf("transaction '%s' splits must all be in one currency: %w", t.ID, err)
+		}
+
+		acct, err := b.account(s.AccountGUID)
+		if err != nil {
+			return err
+		}
+
+		if s.Quantity != nil {
+			qcur, err := b.currency(s.Quantity.Currency)
+			if err != nil {
+				return err
+			}
+
+			if acct.commodityGUID != qcur.guid {
+				return fmt.Errorf("gnucash account '%s' is not in %s, the currency of its split of transaction '%s'", acct.name, s.Quantity.Currency, t.ID)
+			}
+
+			continue
+		}
+
+		if acct.commodityGUID != cur.guid {
+			return fmt.Errorf("gnucash account '%s' is not in %s, the currency of transaction '%s'", acct.name, currency, t.ID)
+		}
+	}
+
+	if !sum.IsZero() {
+		return fmt.Errorf("transaction '%s' does not balance, splits sum to %s", t.ID, sum)
+	}
+
+	txGUID, err := b.newGUID()
+	if err != nil {
+		return err
+	}
+
+	// gnucash posts transactions at 10:59 UTC, so they fall on the same date in almost every timezone
+	posted := time.Date(t.Date.Year(), t.Date.Month(), t.Date.Day(), 10, 59, 0, 0, time.UTC)
+	if _, err := b.tx.Exec("INSERT INTO transactions (guid, currency_guid, num, post_date, enter_date, description) VALUES (?, ?, ?, ?, ?, ?)",
+		txGUID, cur.guid, t.Num, posted.Format(dateTimeFormat), b.now().UTC().Format(dateTimeFormat), t.Description); err != nil {
+		return fmt.Errorf("failed to insert transaction '%s': %w", t.ID, err)
+	}
+
+	for _, s := range t.Splits {
+		if err := b.addSplit(txGUID, cur, s); err != nil {
+			return fmt.Errorf("failed to insert split of transaction '%s': %w", t.ID, err)
+		}
+	}
+
+	if err := b.addSlot(txGUID, IDSlot, slotTypeString, t.ID, nil); err != nil {
+		return err
+	}
+
+	gdate := t.Date.Format("20060102")
+	if err := b.addSlot(txGUID, "date-posted", slotTypeGDate, nil, gdate); err != nil {
+		return err
+	}
+
+	if t.Notes != "" {
+		if err := b.addSlot(txGUID, "notes", slotTypeString, t.Notes, nil); err != nil {
+			return err
+		}
+	}
+
+	b.ids[t.ID] = true
+	return nil
+}
+
+func (b *Book) addSplit(txGUID string, cur commodity, s Split) error {
+	guid, err := b.newGUID()
+	if err != nil {
+		return err
+	}
+
+	value, err := toFraction(s.Amount, cur.fraction)
+	if err != nil {
+		return err
+	}
+
+	// the account is in the transaction's currency unless the split has a quantity,
+	// otherwise its quantity is the same as the value
+	quantity, quantityFraction := value, cur.fraction
+	if s.Quantity != nil {
+		qcur, err := b.currency(s.Quantity.Currency)
+		if err != nil {
+			return err
+		}
+
+		if quantity, err = toFraction(*s.Quantity, qcur.fraction); err != nil {
+			return err
+		}
+
+		quantityFraction = qcur.fraction
+	}
+
+	reconciled := "n"
+	if s.Cleared {
+		reconciled = "c"
+	}
+
+	_, err = b.tx.Exec(`INSERT INTO splits (guid, tx_guid, account_guid, memo, action, reconcile_state, reconcile_date,
+		value_num, value_denom, quantity_num, quantity_denom, lot_guid) VALUES (?, ?, ?, ?, '', ?, NULL, ?, ?, ?, ?, NULL)`,
+		guid, txGUID, s.AccountGUID, s.Memo, reconciled, value, cur.fraction, quantity, quantityFraction)
+	return err
+}
+
+func (b *Book) addSlot(objGUID, name string, slotType int, stringVal, gdateVal interface{}) error {
+	if _, err := b.tx.Exec(`INSERT INTO slots (obj_guid, name, slot_type, int64_val, string_val, double_val, timespec_val,
+		guid_val, numeric_val_num, numeric_val_denom, gdate_val) VALUES (?, ?, ?, 0, ?, 0, NULL, NULL, 0, 1, ?)`,
+		objGUID, name, slotType, stringVal, gdateVal); err != nil {
+		return fmt.Errorf("failed to insert slot '%s': %w", name, err)
+	}
+
+	return nil
+}
+
+func (b *Book) currency(mnemonic string) (commodity, error) {
+	if c, ok := b.currencies[mnemonic]; ok {
+		return c, nil
+	}
+
+	var c commodity
+	err := b.tx.QueryRow("SELECT guid, fraction FROM commodities WHERE namespace = 'CURRENCY' AND mnemonic = ?",
+		strings.ToUpper(mnemonic)).Scan(&c.guid, &c.fraction)
+	if errors.Is(err, sql.ErrNoRows) {
+		return commodity{}, fmt.Errorf("currency '%s' is not in gnucash book '%s'", mnemonic, b.path)
+	} else if err != nil {
+		return commodity{}, fmt.Errorf("failed to look up currency '%s': %w", mnemonic, err)
+	}
+
+	b.currencies[mnemonic] = c
+	return c, nil
+}
+
+func (b *Book) account(guid string) (account, error) {
+	if a, ok := b.accounts[guid]; ok {
+		return a, nil
+	}
+
+	var a account
+	err := b.tx.QueryRow("SELECT name, commodity_guid FROM accounts WHERE guid = ?", guid).Scan(&a.name, &a.commodityGUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return account{}, fmt.Errorf("account '%s' is not in gnucash book '%s'", guid, b.path)
+	} else if err != nil {
+		return account{}, fmt.Errorf("failed to look up account '%s': %w", guid, err)
+	}
+
+	b.accounts[guid] = a
+	return a, nil
+}
+
+// Close saves every transaction added to the book, and closes it
+func (b *Book) Close() error {
+	if b.db == nil {
+		return nil
+	}
+
+	commitErr := b.tx.Commit()
+	closeErr := b.db.Close()
+	b.db = nil
+
+	if commitErr != nil {
+		return fmt.Errorf("failed to save gnucash book '%s': %w", b.path, commitErr)
+	}
+
+	if closeErr != nil {
+		return fmt.Errorf("failed to close gnucash book '%s': %w", b.path, closeErr)
+	}
+
+	return nil
+}
+
+// toFraction returns an amount as a number of 1/fraction units, as gnucash stores amounts as fractions
+func toFraction(a money.Amount, fraction int64) (int64, error) {
+	scale := int64(1)
+	for i := 0; i < money.Exponent(a.Currency); i++ {
+		scale *= 10
+	}
+
+	if (a.Minor*fraction)%scale != 0 {
+		return 0, fmt.Errorf("amount %s %s cannot be stored in 1/%d units", a, a.Currency, fraction)
+	}
+
+	return a.Minor * fraction / scale, nil
+}
+
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate guid: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,244 @@
+package gnucash
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// testBook creates a book with the parts of the gnucash schema used, returning its path
+func testBook(t *testing.T) string {
+	t.Helper()
+
+	schema, err := os.ReadFile(filepath.Join("testdata", "schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.gnucash")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func testTransaction(id string) Transaction {
+	return Transaction{
+		ID:          id,
+		Date:        time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Description: "Tesco",
+		Num:         "1042",
+		Notes:       "Pending",
+		Splits: []Split{
+			{AccountGUID: "current", Amount: money.MustParse("-10.26", "GBP"), Cleared: true},
+			{AccountGUID: "groceries", Amount: money.MustParse("10.26", "GBP"), Memo: "food"},
+		},
+	}
+}
+
+func openTestBook(t *testing.T, path string) *Book {
+	t.Helper()
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guids := 0
+	b.newGUID = func() (string, error) {
+		guids++
+		return fmt.Sprintf("guid%d", guids), nil
+	}
+	b.now = func() time.Time { return time.Date(2020, 2, 1, 12, 30, 0, 0, time.UTC) }
+
+	return b
+}
+
+func TestBook_AddTransaction(t *testing.T) {
+	path := testBook(t)
+
+	b := openTestBook(t, path)
+	if err := b.AddTransaction(testTransaction("tx-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var tx []string
+	var num, postDate, enterDate, description string
+	if err := db.QueryRow("SELECT num, post_date, enter_date, description FROM transactions WHERE guid = 'guid1' AND currency_guid = 'gbp'").
+		Scan(&num, &postDate, &enterDate, &description); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = append(tx, num, postDate, enterDate, description)
+	expectTx := []string{"1042", "2020-01-02 10:59:00", "2020-02-01 12:30:00", "Tesco"}
+	if !reflect.DeepEqual(tx, expectTx) {
+		t.Fatalf("mismatch in transaction\nhave: %v\nwant: %v", tx, expectTx)
+	}
+
+	rows, err := db.Query("SELECT account_guid, memo, reconcile_state, value_num, value_denom, quantity_num, quantity_denom FROM splits WHERE tx_guid = 'guid1' ORDER BY guid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var splits []string
+	for rows.Next() {
+		var acct, memo, reconciled string
+		var valueNum, valueDenom, quantityNum, quantityDenom int64
+		if err := rows.Scan(&acct, &memo, &reconciled, &valueNum, &valueDenom, &quantityNum, &quantityDenom); err != nil {
+			t.Fatal(err)
+		}
+
+		splits = append(splits, fmt.Sprintf("%s %q %s %d/%d %d/%d", acct, memo, reconciled, valueNum, valueDenom, quantityNum, quantityDenom))
+	}
+
+	expectSplits := []string{`current "" c -1026/100 -1026/100`, `groceries "food" n 1026/100 1026/100`}
+	if !reflect.DeepEqual(splits, expectSplits) {
+		t.Fatalf("mismatch in splits\nhave: %v\nwant: %v", splits, expectSplits)
+	}
+
+	b = openTestBook(t, path)
+	defer b.Close()
+
+	if !b.HasTransaction("tx-1") {
+		t.Fatal("expected transaction added to book to be found after reopening it")
+	}
+
+	if b.HasTransaction("tx-2") {
+		t.Fatal("expected transaction not added to book not to be found")
+	}
+}
+
+func TestBook_AddTransactionQuantity(t *testing.T) {
+	path := testBook(t)
+
+	tx := testTransaction("tx-1")
+	tx.Splits[0].AccountGUID = "dollars"
+	tx.Splits[0].Quantity = &money.Amount{Minor: -1283, Currency: "USD"}
+
+	b := openTestBook(t, path)
+	if err := b.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var valueNum, quantityNum int64
+	if err := db.QueryRow("SELECT value_num, quantity_num FROM splits WHERE account_guid = 'dollars'").Scan(&valueNum, &quantityNum); err != nil {
+		t.Fatal(err)
+	}
+
+	if valueNum != -1026 || quantityNum != -1283 {
+		t.Fatalf("mismatch in split value and quantity\nhave: %d, %d\nwant: -1026, -1283", valueNum, quantityNum)
+	}
+}
+
+func TestBook_AddTransactionErrors(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Modify func(tx *Transaction)
+		Err    string
+	}{
+		{
+			Name:   "Unbalanced",
+			Modify: func(tx *Transaction) { tx.Splits[1].Amount = money.MustParse("10", "GBP") },
+			Err:    "transaction 'tx-1' does not balance, splits sum to -0.26",
+		},
+		{
+			Name:   "UnknownAccount",
+			Modify: func(tx *Transaction) { tx.Splits[1].AccountGUID = "dining" },
+			Err:    "account 'dining' is not in gnucash book",
+		},
+		{
+			Name:   "WrongCurrency",
+			Modify: func(tx *Transaction) { tx.Splits[1].AccountGUID = "dollars" },
+			Err:    "gnucash account 'Dollar Account' is not in GBP, the currency of transaction 'tx-1'",
+		},
+		{
+			Name: "WrongQuantityCurrency",
+			Modify: func(tx *Transaction) {
+				tx.Splits[0].Quantity = &money.Amount{Minor: -1283, Currency: "USD"}
+			},
+			Err: "gnucash account 'Current Account' is not in USD, the currency of its split of transaction 'tx-1'",
+		},
+		{
+			Name: "UnknownCurrency",
+			Modify: func(tx *Transaction) {
+				tx.Splits[0].Amount = money.MustParse("-10.26", "EUR")
+				tx.Splits[1].Amount = money.MustParse("10.26", "EUR")
+			},
+			Err: "currency 'EUR' is not in gnucash book",
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			b := openTestBook(t, testBook(t))
+			defer b.Close()
+
+			tx := testTransaction("tx-1")
+			tst.Modify(&tx)
+
+			if err := b.AddTransaction(tx); err == nil || !strings.Contains(err.Error(), tst.Err) {
+				t.Fatalf("expected error containing '%s', got: %v", tst.Err, err)
+			}
+		})
+	}
+}
+
+func TestOpen_Locked(t *testing.T) {
+	path := testBook(t)
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO gnclock VALUES ('localhost', 1234)"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "is open in gnucash") {
+		t.Fatalf("expected locked book error, got: %v", err)
+	}
+}
+
+func TestOpen_NoBook(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.gnucash")); err == nil {
+		t.Fatal("expected error opening missing book")
+	}
+}
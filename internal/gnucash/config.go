@@ -0,0 +1,62 @@
+package gnucash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chill/plaidqif/internal/files"
+)
+
+// Config is the gnucash book to add transactions to, and the GUIDs of the gnucash accounts to add them to
+type Config struct {
+	// Book is the path of the gnucash sqlite book
+	Book string
+	// Accounts maps "<institution>/<account name>" to the GUID of a plaid account's gnucash account
+	Accounts map[string]string
+	// Categories maps your categories to the GUIDs of gnucash accounts
+	Categories map[string]string
+	// Default is the GUID of the gnucash account for categories with no mapping, such as Imbalance-GBP
+	Default string
+}
+
+// LoadConfig assumes confDir already exists. If there is no gnucash config file, the returned Config is empty.
+func LoadConfig(confDir, filename string) (Config, error) {
+	if filename == "" {
+		filename = "gnucash.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var c Config
+	err := files.Unmarshal(path, "gnucash", &c)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+// Account returns the GUID of the gnucash account for a plaid account
+func (c Config) Account(institution, account string) (string, error) {
+	guid, ok := c.Accounts[institution+"/"+account]
+	if !ok {
+		return "", fmt.Errorf("no gnucash account configured for '%s/%s'", institution, account)
+	}
+
+	return guid, nil
+}
+
+// Category returns the GUID of the gnucash account for a category, or the default account if it has no mapping
+func (c Config) Category(category string) (string, error) {
+	if guid, ok := c.Categories[category]; ok {
+		return guid, nil
+	}
+
+	if c.Default == "" {
+		return "", fmt.Errorf("no gnucash account configured for category '%s', and no default", category)
+	}
+
+	return c.Default, nil
+}
@@ -0,0 +1,11 @@
+CREATE TABLE gnclock ( Hostname varchar(255), PID int );
+CREATE TABLE commodities(guid text(32) PRIMARY KEY NOT NULL, namespace text(2048) NOT NULL, mnemonic text(2048) NOT NULL, fullname text(2048), cusip text(2048), fraction integer NOT NULL, quote_flag integer NOT NULL, quote_source text(2048), quote_tz text(2048));
+CREATE TABLE accounts(guid text(32) PRIMARY KEY NOT NULL, name text(2048) NOT NULL, account_type text(2048) NOT NULL, commodity_guid text(32), commodity_scu integer NOT NULL, non_std_scu integer NOT NULL, parent_guid text(32), code text(2048), description text(2048), hidden integer, placeholder integer);
+CREATE TABLE transactions(guid text(32) PRIMARY KEY NOT NULL, currency_guid text(32) NOT NULL, num text(2048) NOT NULL, post_date text(19), enter_date text(19), description text(2048));
+CREATE TABLE splits(guid text(32) PRIMARY KEY NOT NULL, tx_guid text(32) NOT NULL, account_guid text(32) NOT NULL, memo text(2048) NOT NULL, action text(2048) NOT NULL, reconcile_state text(1) NOT NULL, reconcile_date text(19), value_num bigint NOT NULL, value_denom bigint NOT NULL, quantity_num bigint NOT NULL, quantity_denom bigint NOT NULL, lot_guid text(32));
+CREATE TABLE slots(id integer PRIMARY KEY AUTOINCREMENT NOT NULL, obj_guid text(32) NOT NULL, name text(4096) NOT NULL, slot_type integer NOT NULL, int64_val bigint, string_val text(4096), double_val float8, timespec_val text(19), guid_val text(32), numeric_val_num bigint, numeric_val_denom bigint, gdate_val text(8));
+INSERT INTO commodities VALUES ('gbp', 'CURRENCY', 'GBP', 'Pound Sterling', '826', 100, 1, 'currency', '');
+INSERT INTO commodities VALUES ('usd', 'CURRENCY', 'USD', 'US Dollar', '840', 100, 1, 'currency', '');
+INSERT INTO accounts VALUES ('current', 'Current Account', 'BANK', 'gbp', 100, 0, 'assets', '', '', 0, 0);
+INSERT INTO accounts VALUES ('groceries', 'Groceries', 'EXPENSE', 'gbp', 100, 0, 'expenses', '', '', 0, 0);
+INSERT INTO accounts VALUES ('dollars', 'Dollar Account', 'BANK', 'usd', 100, 0, 'assets', '', '', 0, 0);
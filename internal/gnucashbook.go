@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/gnucash"
+)
+
+// gnucashBook adds transactions straight to a gnucash book, skipping any already added to it.
+// gnucashBook is not safe for concurrent use.
+type gnucashBook struct {
+	config  gnucash.Config
+	book    *gnucash.Book
+	skipped int
+	pending int
+}
+
+func newGnuCashBook(config gnucash.Config) (*gnucashBook, error) {
+	if config.Book == "" {
+		return nil, fmt.Errorf("no gnucash book configured in gnucash.json")
+	}
+
+	book, err := gnucash.Open(config.Book)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gnucashBook{config: config, book: book}, nil
+}
+
+// destination is the book, as every account is added to it
+func (g *gnucashBook) destination(string, plaid.AccountBase) string {
+	return g.config.Book
+}
+
+func (g *gnucashBook) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	acctGUID, err := g.config.Account(institution, acct.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range transactions {
+		if tx.source.Pending {
+			// pending transactions get a new transaction id once posted, so would be added twice
+			g.pending++
+			continue
+		}
+
+		// a transfer splits into both accounts, so is only added from the account money leaves,
+		// which plaid gives a positive amount, and which is written in the same run
+		if tx.transfer != nil && tx.Amount.Sign() < 0 {
+			continue
+		}
+
+		if g.book.HasTransaction(tx.source.TransactionId) {
+			g.skipped++
+			continue
+		}
+
+		gtx := gnucash.Transaction{
+			ID:          tx.source.TransactionId,
+			Date:        tx.Date,
+			Description: tx.Payee,
+			Num:         tx.Number,
+			Notes:       tx.Memo,
+			// plaid amounts are positive when money leaves the account, gnucash amounts when money enters it
+			Splits: []gnucash.Split{{AccountGUID: acctGUID, Amount: tx.Amount.Neg(), Cleared: true}},
+		}
+
+		// an amount converted to the reporting currency still moves the original amount in and out of accounts
+		converted := tx.original.Currency != tx.Amount.Currency
+		if converted {
+			quantity := tx.original.Neg()
+			gtx.Splits[0].Quantity = &quantity
+		}
+
+		switch {
+		case tx.transfer != nil:
+			guid, err := g.config.Account(tx.transfer.institution, tx.transfer.acct.Name)
+			if err != nil {
+				return err
+			}
+
+			split := gnucash.Split{AccountGUID: guid, Amount: tx.Amount, Cleared: true}
+			if converted {
+				quantity := tx.original
+				split.Quantity = &quantity
+			}
+
+			gtx.Splits = append(gtx.Splits, split)
+		case len(tx.Splits) == 0:
+			guid, err := g.config.Category(tx.Category)
+			if err != nil {
+				return err
+			}
+
+			gtx.Splits = append(gtx.Splits, gnucash.Split{AccountGUID: guid, Amount: tx.Amount})
+		}
+
+		for _, s := range tx.Splits {
+			guid, err := g.config.Category(s.Category)
+			if err != nil {
+				return err
+			}
+
+			gtx.Splits = append(gtx.Splits, gnucash.Split{AccountGUID: guid, Amount: s.Amount, Memo: s.Memo})
+		}
+
+		if err := g.book.AddTransaction(gtx); err != nil {
+			return fmt.Errorf("failed to add transaction to gnucash book: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close saves the transactions added to the book
+func (g *gnucashBook) Close() error {
+	if g.skipped != 0 {
+		fmt.Printf("Skipped %d transactions already in gnucash book\n", g.skipped)
+	}
+
+	if g.pending != 0 {
+		fmt.Printf("Skipped %d pending transactions, which will be added once posted\n", g.pending)
+	}
+
+	g.skipped, g.pending = 0, 0
+	return g.book.Close()
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/chill/plaidqif/internal/files"
@@ -20,16 +21,21 @@ type Institution struct {
 	AccessToken    string
 	ItemID         string
 	ConsentExpires time.Time
+	// Cursor is the transactions sync cursor for this item, empty if never synced
+	Cursor string
+	// Exported maps the plaid transaction ids written out from this item to the file or book each was first written to
+	Exported map[string]string `json:",omitempty"`
 }
 
-// InstitutionManager is not safe for concurrent use
+// InstitutionManager is safe for concurrent use
 type InstitutionManager struct {
 	path         string
+	mu           sync.RWMutex
 	institutions institutions
 }
 
 // NewInstitutionManager assumed confDir already exists.
-// The returned InstitutionManager is not safe for concurrent use.
+// The returned InstitutionManager is safe for concurrent use.
 func NewInstitutionManager(confDir, filename string) (*InstitutionManager, error) {
 	if filename == "" {
 		filename = "institutions.json"
@@ -52,6 +58,9 @@ func NewInstitutionManager(confDir, filename string) (*InstitutionManager, error
 }
 
 func (m *InstitutionManager) GetInstitution(name string) (Institution, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	ins, ok := m.institutions[name]
 	if !ok {
 		return Institution{}, fmt.Errorf("institution '%s' not yet configured", name)
@@ -61,6 +70,9 @@ func (m *InstitutionManager) GetInstitution(name string) (Institution, error) {
 }
 
 func (m *InstitutionManager) AddInstitution(ins Institution) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	var err error
 	if _, ok := m.institutions[ins.Name]; ok {
 		var newName string
@@ -78,6 +90,9 @@ func (m *InstitutionManager) AddInstitution(ins Institution) error {
 }
 
 func (m *InstitutionManager) List() []Institution {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	ordered := make([]Institution, 0, len(m.institutions))
 	for _, ins := range m.institutions {
 		ordered = append(ordered, ins)
@@ -91,6 +106,9 @@ func (m *InstitutionManager) List() []Institution {
 }
 
 func (m *InstitutionManager) UpdateConsentExpiry(name string, newExpiry time.Time) (Institution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	ins, ok := m.institutions[name]
 	if !ok {
 		return Institution{}, fmt.Errorf("institution '%s' not yet configured", name)
@@ -107,7 +125,59 @@ func (m *InstitutionManager) UpdateConsentExpiry(name string, newExpiry time.Tim
 	return ins, nil
 }
 
+// UpdateCursor sets the transactions sync cursor for an institution, to be used as the starting point of its next sync
+func (m *InstitutionManager) UpdateCursor(name, cursor string) (Institution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ins, ok := m.institutions[name]
+	if !ok {
+		return Institution{}, fmt.Errorf("institution '%s' not yet configured", name)
+	}
+
+	ins.Cursor = cursor
+	m.institutions[name] = ins
+	return ins, nil
+}
+
+// ExportedTo returns the file or book a transaction of an institution was first written to, if it was written before
+func (m *InstitutionManager) ExportedTo(name, transactionID string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	path, ok := m.institutions[name].Exported[transactionID]
+	return path, ok
+}
+
+// AddExported records that transactions of an institution were written to path,
+// keeping the path that any were first written to
+func (m *InstitutionManager) AddExported(name, path string, transactionIDs []string) (Institution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ins, ok := m.institutions[name]
+	if !ok {
+		return Institution{}, fmt.Errorf("institution '%s' not yet configured", name)
+	}
+
+	if ins.Exported == nil {
+		ins.Exported = make(map[string]string, len(transactionIDs))
+	}
+
+	for _, id := range transactionIDs {
+		if _, ok := ins.Exported[id]; !ok {
+			ins.Exported[id] = path
+		}
+	}
+
+	m.institutions[name] = ins
+	return ins, nil
+}
+
 func (m *InstitutionManager) WriteInstitutions() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return files.MarshalFile(m.path, "institutions", m.institutions)
 }
 
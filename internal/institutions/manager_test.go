@@ -1,7 +1,9 @@
 package institutions
 
 import (
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -49,3 +51,85 @@ func TestInstitutionManager_GetInstitutions(t *testing.T) {
 		t.Fatalf("mismatch in institutions expected\nhave: %+v\nwant: %+v", ins, expect)
 	}
 }
+
+func TestInstitutionManager_AddExported(t *testing.T) {
+	im, err := NewInstitutionManager("./", "test_institutions.json")
+	if err != nil {
+		t.Fatalf("failed to setup institution manager: %v", err)
+	}
+
+	if _, ok := im.ExportedTo("regular", "tx-1"); ok {
+		t.Fatalf("expected transaction not to be exported yet")
+	}
+
+	if _, err := im.AddExported("regular", "first.qif", []string{"tx-1", "tx-2"}); err != nil {
+		t.Fatalf("failed to add exported transactions: %v", err)
+	}
+
+	// transactions keep the file they were first exported to
+	if _, err := im.AddExported("regular", "second.qif", []string{"tx-2", "tx-3"}); err != nil {
+		t.Fatalf("failed to add exported transactions: %v", err)
+	}
+
+	for id, expect := range map[string]string{"tx-1": "first.qif", "tx-2": "first.qif", "tx-3": "second.qif"} {
+		if path, ok := im.ExportedTo("regular", id); !ok || path != expect {
+			t.Fatalf("mismatch in file transaction '%s' was exported to\nhave: %s\nwant: %s", id, path, expect)
+		}
+	}
+
+	// exports are recorded per institution
+	if _, ok := im.ExportedTo("regular-two", "tx-1"); ok {
+		t.Fatalf("expected transaction not to be exported from another institution")
+	}
+
+	if _, err := im.AddExported("missing", "first.qif", []string{"tx-1"}); err == nil {
+		t.Fatalf("expected error adding exported transactions of missing institution")
+	}
+}
+
+func TestInstitutionManager_ConcurrentUpdates(t *testing.T) {
+	im, err := NewInstitutionManager("./", "test_institutions.json")
+	if err != nil {
+		t.Fatalf("failed to setup institution manager: %v", err)
+	}
+
+	names := []string{"regular", "regular-two", "regular-three"}
+	expiry := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := names[i%len(names)]
+			if _, err := im.UpdateConsentExpiry(name, expiry); err != nil {
+				t.Errorf("failed to update consent expiry: %v", err)
+			}
+
+			if _, err := im.AddExported(name, "out.qif", []string{fmt.Sprintf("tx-%d", i)}); err != nil {
+				t.Errorf("failed to add exported transactions: %v", err)
+			}
+
+			im.List()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 30; i++ {
+		if _, ok := im.ExportedTo(names[i%len(names)], fmt.Sprintf("tx-%d", i)); !ok {
+			t.Fatalf("expected transaction 'tx-%d' to be exported", i)
+		}
+	}
+
+	for _, name := range names {
+		ins, err := im.GetInstitution(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ins.ConsentExpires.Equal(expiry) {
+			t.Fatalf("mismatch in consent expiry of '%s'\nhave: %s\nwant: %s", name, ins.ConsentExpires, expiry)
+		}
+	}
+}
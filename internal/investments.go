@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/qif"
+)
+
+var plaidToQIFSecurityType = map[string]string{
+	"equity":         "Stock",
+	"etf":            "Mutual Fund",
+	"mutual fund":    "Mutual Fund",
+	"fixed income":   "Bond",
+	"derivative":     "Option",
+	"cash":           "Other",
+	"cryptocurrency": "Other",
+	"loan":           "Other",
+	"other":          "Other",
+}
+
+// investmentHoldings are the holdings of every investment account of an institution, and the securities they hold
+type investmentHoldings struct {
+	holdings   []plaid.Holding
+	securities map[string]plaid.Security
+}
+
+func isInvestmentAccount(acct plaid.AccountBase) bool {
+	return plaidToQIFType[acct.Type] == qif.InvestmentAccountType
+}
+
+func (p *PlaidQIF) getInvestmentHoldings(ins institutions.Institution) (investmentHoldings, error) {
+	req := p.client.InvestmentsHoldingsGet(context.TODO())
+	req = req.InvestmentsHoldingsGetRequest(plaid.InvestmentsHoldingsGetRequest{
+		AccessToken: ins.AccessToken,
+	})
+
+	resp, _, err := req.Execute()
+	if err != nil {
+		return investmentHoldings{}, fmt.Errorf("failed to get institution '%s' investment holdings from plaid: %w", ins.Name, err)
+	}
+
+	holdings := investmentHoldings{
+		holdings:   resp.Holdings,
+		securities: make(map[string]plaid.Security, len(resp.Securities)),
+	}
+
+	for _, sec := range resp.Securities {
+		holdings.securities[sec.SecurityId] = sec
+	}
+
+	return holdings, nil
+}
+
+// downloadInvestmentTransactions writes the transactions of an investment account and prices of its holdings,
+// returning how many transactions were written
+func (p *PlaidQIF) downloadInvestmentTransactions(out *qifFiles, ins institutions.Institution, holdings investmentHoldings,
+	acct plaid.AccountBase, from, until time.Time) (int, error) {
+	accountIDs := []string{acct.AccountId}
+	offset := int32(0)
+	count := int32(100)
+	req := &plaid.InvestmentsTransactionsGetRequest{
+		Options: &plaid.InvestmentsTransactionsGetRequestOptions{
+			AccountIds: &accountIDs,
+			Offset:     &offset,
+			Count:      &count,
+		},
+		AccessToken: ins.AccessToken,
+		StartDate:   from.Format(plaidDateFormat),
+		EndDate:     until.Format(plaidDateFormat),
+	}
+
+	var transactions []plaid.InvestmentTransaction
+	securities := make(map[string]plaid.Security)
+	for {
+		txGet := p.client.InvestmentsTransactionsGet(context.TODO())
+		txGet = txGet.InvestmentsTransactionsGetRequest(*req)
+
+		resp, _, err := txGet.Execute()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get investment transactions from plaid: %w", err)
+		}
+
+		transactions = append(transactions, resp.InvestmentTransactions...)
+		for _, sec := range resp.Securities {
+			securities[sec.SecurityId] = sec
+		}
+
+		// req contains a pointer to offset, so updating this updates the request for next time
+		offset += int32(len(resp.InvestmentTransactions))
+		if offset >= resp.TotalInvestmentTransactions || len(resp.InvestmentTransactions) == 0 {
+			break
+		}
+	}
+
+	var held []plaid.Holding
+	for _, h := range holdings.holdings {
+		if h.AccountId != acct.AccountId {
+			continue
+		}
+
+		held = append(held, h)
+		if sec, ok := holdings.securities[h.SecurityId]; ok {
+			securities[h.SecurityId] = sec
+		}
+	}
+
+	if len(transactions) == 0 && len(held) == 0 {
+		return 0, nil
+	}
+
+	w, err := out.writer(ins.Name, acct)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := w.WriteSecurities(convertSecurities(securities)); err != nil {
+		return 0, fmt.Errorf("failed to write securities to qif writer: %w", err)
+	}
+
+	prices, err := convertPrices(held, securities, until)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := w.WritePrices(prices); err != nil {
+		return 0, fmt.Errorf("failed to write prices to qif writer: %w", err)
+	}
+
+	qifTransactions, err := convertInvestmentTransactions(transactions, securities)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := w.WriteInvestmentTransactions(qifTransactions); err != nil {
+		return 0, fmt.Errorf("failed to write investment transactions to qif writer: %w", err)
+	}
+
+	return len(transactions), nil
+}
+
+func convertInvestmentTransactions(transactions []plaid.InvestmentTransaction, securities map[string]plaid.Security) ([]qif.InvestmentTransaction, error) {
+	// plaid dates are ISO 8601, so sort lexically
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date < transactions[j].Date
+	})
+
+	txs := make([]qif.InvestmentTransaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx.Type == "cancel" {
+			// cancellations refer to another transaction, which QIF can't express
+			fmt.Printf("Skipping cancelled investment transaction '%s' on %s: %s\n", tx.InvestmentTransactionId, tx.Date, tx.Name)
+			continue
+		}
+
+		date, err := time.Parse(plaidDateFormat, tx.Date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse investment transaction date for '%s' with date string '%s': %w", tx.Name, tx.Date, err)
+		}
+
+		currency := currencyCode(tx.IsoCurrencyCode, tx.UnofficialCurrencyCode)
+		amount, err := money.FromFloat32(tx.Amount, currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert investment transaction amount for '%s': %w", tx.Name, err)
+		}
+
+		qiftx := qif.InvestmentTransaction{
+			Date:     date,
+			Action:   investmentAction(tx),
+			Price:    exactFloat(tx.Price),
+			Quantity: exactFloat(tx.Quantity),
+			Amount:   amount,
+			Memo:     tx.Name,
+			Cleared:  qif.Reconciled,
+		}
+
+		if id := tx.SecurityId.Get(); id != nil {
+			if sec, ok := securities[*id]; ok {
+				qiftx.Security = securityName(sec)
+			}
+		}
+
+		if fees := tx.Fees.Get(); fees != nil {
+			qiftx.Commission, err = money.FromFloat32(*fees, currency)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert investment transaction fees for '%s': %w", tx.Name, err)
+			}
+		}
+
+		txs = append(txs, qiftx)
+	}
+
+	return txs, nil
+}
+
+// investmentAction maps plaid's investment transaction type and subtype to a QIF action.
+// Plaid amounts are positive when cash leaves the account, and quantities positive when securities enter it.
+func investmentAction(tx plaid.InvestmentTransaction) string {
+	switch tx.Type {
+	case "buy":
+		switch tx.Subtype {
+		case "dividend reinvestment", "reinvestment":
+			return qif.ActionReinvDividend
+		case "interest reinvestment":
+			return qif.ActionReinvInterest
+		case "long-term capital gain reinvestment":
+			return qif.ActionReinvCGLong
+		case "short-term capital gain reinvestment":
+			return qif.ActionReinvCGShort
+		default:
+			return qif.ActionBuy
+		}
+	case "sell":
+		return qif.ActionSell
+	case "fee":
+		if tx.Amount < 0 {
+			return qif.ActionMiscIncome
+		}
+
+		return qif.ActionMiscExpense
+	case "transfer":
+		if tx.Quantity > 0 {
+			return qif.ActionSharesIn
+		} else if tx.Quantity < 0 {
+			return qif.ActionSharesOut
+		}
+	case "cash":
+		switch tx.Subtype {
+		case "dividend", "qualified dividend", "non-qualified dividend":
+			return qif.ActionDividend
+		case "interest":
+			return qif.ActionInterest
+		case "long-term capital gain":
+			return qif.ActionCGLong
+		case "short-term capital gain":
+			return qif.ActionCGShort
+		case "return of principal":
+			return qif.ActionReturnCapital
+		}
+	}
+
+	// anything else only moves cash
+	if tx.Amount < 0 {
+		return qif.ActionCashIn
+	}
+
+	return qif.ActionCashOut
+}
+
+func convertSecurities(securities map[string]plaid.Security) []qif.Security {
+	secs := make([]qif.Security, 0, len(securities))
+	for _, sec := range securities {
+		qifSec := qif.Security{
+			Name: securityName(sec),
+			Type: plaidToQIFSecurityType[sec.GetType()],
+		}
+
+		if ticker := sec.TickerSymbol.Get(); ticker != nil {
+			qifSec.Symbol = *ticker
+		}
+
+		secs = append(secs, qifSec)
+	}
+
+	sort.Slice(secs, func(i, j int) bool {
+		return secs[i].Name < secs[j].Name
+	})
+
+	return secs
+}
+
+// convertPrices returns the institution's price for each held security, dated when the institution priced it,
+// or the end of the download if it didn't say
+func convertPrices(held []plaid.Holding, securities map[string]plaid.Security, until time.Time) ([]qif.Price, error) {
+	prices := make([]qif.Price, 0, len(held))
+	for _, h := range held {
+		sec, ok := securities[h.SecurityId]
+		if !ok {
+			continue
+		}
+
+		date := until
+		if asOf := h.InstitutionPriceAsOf.Get(); asOf != nil {
+			var err error
+			date, err = time.Parse(plaidDateFormat, *asOf)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse price date for security '%s' with date string '%s': %w", securityName(sec), *asOf, err)
+			}
+		}
+
+		symbol := securityName(sec)
+		if ticker := sec.TickerSymbol.Get(); ticker != nil {
+			symbol = *ticker
+		}
+
+		prices = append(prices, qif.Price{
+			Symbol: symbol,
+			Price:  exactFloat(h.InstitutionPrice),
+			Date:   date,
+		})
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Symbol < prices[j].Symbol
+	})
+
+	return prices, nil
+}
+
+// securityName returns the name to identify a security by in QIFs, falling back to its ticker symbol, then id
+func securityName(sec plaid.Security) string {
+	if name := sec.Name.Get(); name != nil && *name != "" {
+		return *name
+	}
+
+	if ticker := sec.TickerSymbol.Get(); ticker != nil && *ticker != "" {
+		return *ticker
+	}
+
+	return sec.SecurityId
+}
+
+// exactFloat converts a float32 from plaid to the float64 with the same shortest decimal representation,
+// so that 10.26 doesn't become 10.260000228881836
+func exactFloat(f float32) float64 {
+	f64, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'f', -1, 32), 64)
+	return f64
+}
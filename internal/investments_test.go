@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/qif"
+)
+
+func TestInvestmentAction(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Type     string
+		Subtype  string
+		Amount   float32
+		Quantity float32
+		Expect   string
+	}{
+		{Name: "Buy", Type: "buy", Subtype: "buy", Amount: 100, Quantity: 2, Expect: qif.ActionBuy},
+		{Name: "ReinvestDividend", Type: "buy", Subtype: "dividend reinvestment", Amount: 10, Quantity: 0.5, Expect: qif.ActionReinvDividend},
+		{Name: "ReinvestInterest", Type: "buy", Subtype: "interest reinvestment", Amount: 10, Quantity: 0.5, Expect: qif.ActionReinvInterest},
+		{Name: "ReinvestLongGain", Type: "buy", Subtype: "long-term capital gain reinvestment", Amount: 10, Expect: qif.ActionReinvCGLong},
+		{Name: "ReinvestShortGain", Type: "buy", Subtype: "short-term capital gain reinvestment", Amount: 10, Expect: qif.ActionReinvCGShort},
+		{Name: "Sell", Type: "sell", Subtype: "sell", Amount: -100, Quantity: -2, Expect: qif.ActionSell},
+		{Name: "Fee", Type: "fee", Subtype: "account fee", Amount: 5, Expect: qif.ActionMiscExpense},
+		{Name: "FeeRefund", Type: "fee", Subtype: "account fee", Amount: -5, Expect: qif.ActionMiscIncome},
+		{Name: "SharesIn", Type: "transfer", Subtype: "transfer", Quantity: 3, Expect: qif.ActionSharesIn},
+		{Name: "SharesOut", Type: "transfer", Subtype: "transfer", Quantity: -3, Expect: qif.ActionSharesOut},
+		{Name: "CashTransferIn", Type: "transfer", Subtype: "transfer", Amount: -50, Expect: qif.ActionCashIn},
+		{Name: "Dividend", Type: "cash", Subtype: "qualified dividend", Amount: -10, Expect: qif.ActionDividend},
+		{Name: "Interest", Type: "cash", Subtype: "interest", Amount: -1, Expect: qif.ActionInterest},
+		{Name: "LongGain", Type: "cash", Subtype: "long-term capital gain", Amount: -20, Expect: qif.ActionCGLong},
+		{Name: "ShortGain", Type: "cash", Subtype: "short-term capital gain", Amount: -20, Expect: qif.ActionCGShort},
+		{Name: "ReturnOfPrincipal", Type: "cash", Subtype: "return of principal", Amount: -30, Expect: qif.ActionReturnCapital},
+		{Name: "Deposit", Type: "cash", Subtype: "deposit", Amount: -500, Expect: qif.ActionCashIn},
+		{Name: "Withdrawal", Type: "cash", Subtype: "withdrawal", Amount: 500, Expect: qif.ActionCashOut},
+		{Name: "Cancel", Type: "cancel", Subtype: "cancel", Amount: 100, Expect: qif.ActionCashOut},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			action := investmentAction(plaid.InvestmentTransaction{
+				Type:     tst.Type,
+				Subtype:  tst.Subtype,
+				Amount:   tst.Amount,
+				Quantity: tst.Quantity,
+			})
+
+			if action != tst.Expect {
+				t.Fatalf("mismatch in action\nhave: %s\nwant: %s", action, tst.Expect)
+			}
+		})
+	}
+}
+
+func testSecurity(id, name, ticker, kind string) plaid.Security {
+	sec := plaid.Security{SecurityId: id}
+	if name != "" {
+		sec.Name.Set(&name)
+	}
+
+	if ticker != "" {
+		sec.TickerSymbol.Set(&ticker)
+	}
+
+	if kind != "" {
+		sec.Type.Set(&kind)
+	}
+
+	return sec
+}
+
+func TestConvertSecurities(t *testing.T) {
+	securities := map[string]plaid.Security{
+		"vwrl": testSecurity("vwrl", "Vanguard FTSE All-World", "VWRL", "etf"),
+		"aapl": testSecurity("aapl", "Apple Inc.", "AAPL", "equity"),
+		"gilt": testSecurity("gilt", "", "TG25", "fixed income"),
+		"cash": testSecurity("cash", "", "", "cash"),
+		"odd":  testSecurity("odd", "Odd Thing", "", "collectible"),
+	}
+
+	expect := []qif.Security{
+		{Name: "Apple Inc.", Symbol: "AAPL", Type: "Stock"},
+		{Name: "Odd Thing"},
+		{Name: "TG25", Symbol: "TG25", Type: "Bond"},
+		{Name: "Vanguard FTSE All-World", Symbol: "VWRL", Type: "Mutual Fund"},
+		{Name: "cash", Type: "Other"},
+	}
+
+	if secs := convertSecurities(securities); !reflect.DeepEqual(secs, expect) {
+		t.Fatalf("mismatch in securities\nhave: %+v\nwant: %+v", secs, expect)
+	}
+}
+
+func TestConvertPrices(t *testing.T) {
+	securities := map[string]plaid.Security{
+		"vwrl": testSecurity("vwrl", "Vanguard FTSE All-World", "VWRL", "etf"),
+		"fund": testSecurity("fund", "Unlisted Fund", "", "mutual fund"),
+	}
+
+	until := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	priced := plaid.Holding{SecurityId: "vwrl", InstitutionPrice: 102.26}
+	priced.InstitutionPriceAsOf.Set(stringPtr("2024-01-29"))
+
+	held := []plaid.Holding{
+		priced,
+		{SecurityId: "fund", InstitutionPrice: 1.5},
+		// holdings of securities plaid didn't return are skipped
+		{SecurityId: "missing", InstitutionPrice: 9.99},
+	}
+
+	prices, err := convertPrices(held, securities, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []qif.Price{
+		{Symbol: "Unlisted Fund", Price: 1.5, Date: until},
+		{Symbol: "VWRL", Price: 102.26, Date: time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	if !reflect.DeepEqual(prices, expect) {
+		t.Fatalf("mismatch in prices\nhave: %+v\nwant: %+v", prices, expect)
+	}
+
+	bad := plaid.Holding{SecurityId: "vwrl", InstitutionPrice: 1}
+	bad.InstitutionPriceAsOf.Set(stringPtr("29/01/2024"))
+	if _, err := convertPrices([]plaid.Holding{bad}, securities, until); err == nil {
+		t.Fatal("expected error converting price with unparseable date")
+	}
+}
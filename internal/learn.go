@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chill/plaidqif/internal/learned"
+	"github.com/chill/plaidqif/internal/qif"
+)
+
+// LearnCategories reads QIFs, such as ones whose categories were corrected after importing them, and observes
+// the category given to each payee, so later downloads can suggest or apply them. Reading a QIF again replaces
+// what was observed from the same transactions before. QIFs don't record currency, so amounts are read as currency.
+func (p *PlaidQIF) LearnCategories(paths []string, currency string) error {
+	for _, path := range paths {
+		learnt, skipped, err := p.learnQIFCategories(path, currency)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Learned %d categories from '%s', skipped %d transactions without one\n", learnt, path, skipped)
+	}
+
+	return nil
+}
+
+func (p *PlaidQIF) learnQIFCategories(path, currency string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open qif file '%s' for reading: %w", path, err)
+	}
+	defer f.Close()
+
+	accounts, err := qif.NewReader(f, p.dateFormat, currency).ReadAll()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read qif file '%s': %w", path, err)
+	}
+
+	var observations []learned.Observation
+	var skipped int
+	for _, acct := range accounts {
+		for _, tx := range acct.Transactions {
+			// split transactions have no one category, and transfers aren't categories
+			payee := learned.NormalizePayee(tx.Payee)
+			if payee == "" || tx.Category == "" || len(tx.Splits) != 0 || strings.HasPrefix(tx.Category, "[") {
+				skipped++
+				continue
+			}
+
+			observations = append(observations, learned.Observation{
+				Key:      fmt.Sprintf("%s:%s:%s:%s:%s", learned.SourceQIF, acct.Name, tx.Date.Format(plaidDateFormat), tx.Amount, tx.Payee),
+				Source:   learned.SourceQIF,
+				Payee:    payee,
+				Category: tx.Category,
+				Amount:   tx.Amount,
+			})
+		}
+	}
+
+	if err := p.store.PutObservations(observations); err != nil {
+		return 0, 0, err
+	}
+
+	return len(observations), skipped, nil
+}
@@ -0,0 +1,144 @@
+package learned
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Sources of observations
+const (
+	// SourceQIF observations come from categories in QIFs read back in, such as after correcting them in an app
+	SourceQIF = "qif"
+	// SourceRule observations come from categories set by payee rules
+	SourceRule = "rule"
+)
+
+// similarAmount is how far, as a fraction, an amount can be from an observed amount to count as similar
+const similarAmount = 0.25
+
+// Observation is a category given to a payee, for a transaction of some amount
+type Observation struct {
+	// Key identifies the transaction observed, so observing it again replaces the earlier observation
+	Key      string
+	Source   string
+	Payee    string
+	Category string
+	Amount   money.Amount
+}
+
+// Suggestion is a learned category for a transaction, with a confidence between 0 and 1
+type Suggestion struct {
+	Category   string
+	Confidence float64
+}
+
+// Config holds the confidences above which learned categories are used
+type Config struct {
+	// Apply is the confidence at or above which a learned category replaces the mapped category, defaulting to 0.9
+	Apply float64
+	// Suggest is the confidence at or above which a learned category is suggested in the memo, defaulting to 0.5
+	Suggest float64
+}
+
+// LoadConfig assumes confDir already exists. If there is no learning config file, the returned Config has the defaults.
+func LoadConfig(confDir, filename string) (Config, error) {
+	if filename == "" {
+		filename = "learning.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var c Config
+	err := files.Unmarshal(path, "learning", &c)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return Config{}, err
+	}
+
+	if c.Apply == 0 {
+		c.Apply = 0.9
+	}
+
+	if c.Suggest == 0 {
+		c.Suggest = 0.5
+	}
+
+	if c.Apply < 0 || c.Suggest < 0 {
+		return Config{}, fmt.Errorf("negative confidence in learning file '%s'", path)
+	}
+
+	return c, nil
+}
+
+// NormalizePayee reduces a payee to lowercase words without digits or punctuation, so that payees differing only
+// by store numbers or references, such as "TESCO STORES 1234" and "Tesco Stores 5678", are observed together
+func NormalizePayee(payee string) string {
+	words := strings.FieldsFunc(strings.ToLower(payee), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	return strings.Join(words, " ")
+}
+
+// Suggest returns the category most often given to a payee, from its observations. Observations for amounts
+// similar to the transaction's count double, and confidence grows with the number of observations.
+func Suggest(observations []Observation, amount money.Amount) Suggestion {
+	weights := make(map[string]float64)
+	var total float64
+	for _, o := range observations {
+		w := 0.5
+		if isSimilar(o.Amount, amount) {
+			w = 1
+		}
+
+		weights[o.Category] += w
+		total += w
+	}
+
+	if total == 0 {
+		return Suggestion{}
+	}
+
+	categories := make([]string, 0, len(weights))
+	for c := range weights {
+		categories = append(categories, c)
+	}
+
+	// ties go to the first category alphabetically, so suggestions are stable
+	sort.Strings(categories)
+
+	best := categories[0]
+	for _, c := range categories[1:] {
+		if weights[c] > weights[best] {
+			best = c
+		}
+	}
+
+	n := float64(len(observations))
+	return Suggestion{
+		Category:   best,
+		Confidence: weights[best] / total * n / (n + 1),
+	}
+}
+
+func isSimilar(observed, amount money.Amount) bool {
+	if observed.Currency != amount.Currency || observed.Sign() != amount.Sign() {
+		return false
+	}
+
+	a, o := math.Abs(float64(amount.Minor)), math.Abs(float64(observed.Minor))
+	return math.Abs(a-o) <= similarAmount*o
+}
+
+// Memo returns the memo suggesting a category
+func (s Suggestion) Memo() string {
+	return fmt.Sprintf("Suggested category: %s (%.0f%%)", s.Category, s.Confidence*100)
+}
@@ -0,0 +1,119 @@
+package learned
+
+import (
+	"math"
+	"testing"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+func TestNormalizePayee(t *testing.T) {
+	tests := map[string]string{
+		"TESCO STORES 1234":   "tesco stores",
+		"Tesco Stores 5678":   "tesco stores",
+		"AMZN Mktp UK*2K3L45": "amzn mktp uk k l",
+		"  Pret-A-Manger ":    "pret a manger",
+		"1234":                "",
+	}
+
+	for payee, expect := range tests {
+		if got := NormalizePayee(payee); got != expect {
+			t.Fatalf("mismatch in normalized payee of '%s'\nhave: %s\nwant: %s", payee, got, expect)
+		}
+	}
+}
+
+func observation(category, amount string) Observation {
+	return Observation{Payee: "tesco stores", Category: category, Amount: money.MustParse(amount, "GBP")}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		Name         string
+		Observations []Observation
+		Amount       string
+		Expect       Suggestion
+	}{
+		{
+			Name:   "NoObservations",
+			Amount: "10",
+		},
+		{
+			Name:         "One",
+			Observations: []Observation{observation("Groceries", "10")},
+			Amount:       "10",
+			Expect:       Suggestion{Category: "Groceries", Confidence: 0.5},
+		},
+		{
+			Name: "Unanimous",
+			Observations: []Observation{
+				observation("Groceries", "10"),
+				observation("Groceries", "12"),
+				observation("Groceries", "9"),
+				observation("Groceries", "50"),
+			},
+			Amount: "10",
+			Expect: Suggestion{Category: "Groceries", Confidence: 0.8},
+		},
+		{
+			Name: "SimilarAmountsCountDouble",
+			Observations: []Observation{
+				observation("Groceries", "10"),
+				observation("Household", "100"),
+				observation("Household", "110"),
+			},
+			Amount: "11",
+			// groceries 1, household 0.5 + 0.5, and the tie goes to groceries alphabetically
+			Expect: Suggestion{Category: "Groceries", Confidence: 0.5 * 3 / 4},
+		},
+		{
+			Name: "Majority",
+			Observations: []Observation{
+				observation("Household", "100"),
+				observation("Household", "110"),
+				observation("Groceries", "10"),
+			},
+			Amount: "105",
+			Expect: Suggestion{Category: "Household", Confidence: 2.0 / 2.5 * 3 / 4},
+		},
+		{
+			Name: "RefundsAreNotSimilar",
+			Observations: []Observation{
+				observation("Groceries", "10"),
+				observation("Refunds", "-10"),
+			},
+			Amount: "-10",
+			Expect: Suggestion{Category: "Refunds", Confidence: 1.0 / 1.5 * 2 / 3},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			s := Suggest(tst.Observations, money.MustParse(tst.Amount, "GBP"))
+			if s.Category != tst.Expect.Category || math.Abs(s.Confidence-tst.Expect.Confidence) > 1e-9 {
+				t.Fatalf("mismatch in suggestion\nhave: %+v\nwant: %+v", s, tst.Expect)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig("./", "test_missing_learning.json")
+	if err != nil {
+		t.Fatalf("failed to load missing learning config: %v", err)
+	}
+
+	if c != (Config{Apply: 0.9, Suggest: 0.5}) {
+		t.Fatalf("mismatch in default learning config: %+v", c)
+	}
+
+	c, err = LoadConfig("./", "test_learning.json")
+	if err != nil {
+		t.Fatalf("failed to load learning config: %v", err)
+	}
+
+	if c != (Config{Apply: 0.75, Suggest: 0.5}) {
+		t.Fatalf("mismatch in learning config: %+v", c)
+	}
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// liability is the summary of a credit card or loan account's debt shown by ListLiabilities
+type liability struct {
+	kind           string
+	apr            string
+	minimumPayment string
+	nextDue        string
+	principal      string
+}
+
+func (p *PlaidQIF) ListLiabilities(names []string) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Liabilities:")
+	fmt.Fprintln(tw, "Institution\tName\tKind\tAPR\tMinimum Payment\tNext Due\tOutstanding Principal\t")
+	fmt.Fprintln(tw, "-----------\t----\t----\t---\t---------------\t--------\t---------------------\t")
+
+	institutions, err := p.institutions.GetInstitutions(names)
+	if err != nil {
+		return err
+	}
+
+	for _, ins := range institutions {
+		if err := p.listInstitutionLiabilities(tw, ins); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *PlaidQIF) listInstitutionLiabilities(tw *tabwriter.Writer, ins institutions.Institution) error {
+	req := p.client.LiabilitiesGet(context.TODO())
+	req = req.LiabilitiesGetRequest(plaid.LiabilitiesGetRequest{
+		AccessToken: ins.AccessToken,
+	})
+
+	resp, _, err := req.Execute()
+	if err != nil {
+		return fmt.Errorf("failed to get institution '%s' liabilities from plaid: %w", ins.Name, err)
+	}
+
+	accounts := make(map[string]plaid.AccountBase, len(resp.Accounts))
+	for _, acct := range resp.Accounts {
+		accounts[acct.AccountId] = acct
+	}
+
+	liabilities, err := convertLiabilities(resp.Liabilities, accounts)
+	if err != nil {
+		return fmt.Errorf("failed to convert institution '%s' liabilities: %w", ins.Name, err)
+	}
+
+	for _, acct := range resp.Accounts {
+		l, ok := liabilities[acct.AccountId]
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t",
+			ins.Name, acct.Name, l.kind, l.apr, l.minimumPayment, l.nextDue, l.principal))
+	}
+
+	return nil
+}
+
+// convertLiabilities returns a liability for each account plaid returned liabilities for, keyed by account ID
+func convertLiabilities(lo plaid.LiabilitiesObject, accounts map[string]plaid.AccountBase) (map[string]liability, error) {
+	liabilities := make(map[string]liability)
+
+	for _, c := range lo.Credit {
+		id := c.AccountId.Get()
+		if id == nil {
+			continue
+		}
+
+		acct := accounts[*id]
+		currency := currencyCode(acct.Balances.IsoCurrencyCode, acct.Balances.UnofficialCurrencyCode)
+		l := liability{kind: "Credit Card", nextDue: nullableString(c.NextPaymentDueDate)}
+		if len(c.Aprs) != 0 {
+			l.apr = formatPercent(creditAPR(c.Aprs))
+		}
+
+		var err error
+		if l.minimumPayment, err = formatAmount(c.MinimumPaymentAmount, currency); err != nil {
+			return nil, err
+		}
+
+		if l.principal, err = formatNullableAmount(acct.Balances.Current, currency); err != nil {
+			return nil, err
+		}
+
+		liabilities[*id] = l
+	}
+
+	for _, m := range lo.Mortgage {
+		acct := accounts[m.AccountId]
+		currency := currencyCode(acct.Balances.IsoCurrencyCode, acct.Balances.UnofficialCurrencyCode)
+		l := liability{kind: "Mortgage", nextDue: nullableString(m.NextPaymentDueDate)}
+		if rate := m.InterestRate.Percentage.Get(); rate != nil {
+			l.apr = formatPercent(*rate)
+		}
+
+		var err error
+		if l.minimumPayment, err = formatNullableAmount(m.NextMonthlyPayment, currency); err != nil {
+			return nil, err
+		}
+
+		if l.principal, err = formatNullableAmount(acct.Balances.Current, currency); err != nil {
+			return nil, err
+		}
+
+		liabilities[m.AccountId] = l
+	}
+
+	for _, s := range lo.Student {
+		id := s.AccountId.Get()
+		if id == nil {
+			continue
+		}
+
+		acct := accounts[*id]
+		currency := currencyCode(acct.Balances.IsoCurrencyCode, acct.Balances.UnofficialCurrencyCode)
+		l := liability{
+			kind:    "Student Loan",
+			apr:     formatPercent(s.InterestRatePercentage),
+			nextDue: nullableString(s.NextPaymentDueDate),
+		}
+
+		var err error
+		if l.minimumPayment, err = formatNullableAmount(s.MinimumPaymentAmount, currency); err != nil {
+			return nil, err
+		}
+
+		if l.principal, err = studentLoanPrincipal(s, acct.Balances.Current, currency); err != nil {
+			return nil, err
+		}
+
+		liabilities[*id] = l
+	}
+
+	return liabilities, nil
+}
+
+// studentLoanPrincipal returns the outstanding principal of a student loan, as its current balance includes interest,
+// which isn't principal
+func studentLoanPrincipal(s plaid.StudentLoan, balance plaid.NullableFloat32, currency string) (string, error) {
+	current := balance.Get()
+	if current == nil {
+		return "", nil
+	}
+
+	principal, err := money.FromFloat32(*current, currency)
+	if err != nil {
+		return "", err
+	}
+
+	if i := s.OutstandingInterestAmount.Get(); i != nil {
+		interest, err := money.FromFloat32(*i, currency)
+		if err != nil {
+			return "", err
+		}
+
+		if principal, err = principal.Add(interest.Neg()); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s %s", principal, currency), nil
+}
+
+// creditAPR returns the purchase APR of a credit card, or its first APR if it has no purchase APR
+func creditAPR(aprs []plaid.APR) float32 {
+	for _, apr := range aprs {
+		if apr.AprType == "purchase_apr" {
+			return apr.AprPercentage
+		}
+	}
+
+	return aprs[0].AprPercentage
+}
+
+func formatPercent(f float32) string {
+	return strconv.FormatFloat(exactFloat(f), 'f', -1, 64) + "%"
+}
+
+func formatAmount(f float32, currency string) (string, error) {
+	amount, err := money.FromFloat32(f, currency)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s", amount, currency), nil
+}
+
+func formatNullableAmount(f plaid.NullableFloat32, currency string) (string, error) {
+	if v := f.Get(); v != nil {
+		return formatAmount(*v, currency)
+	}
+
+	return "", nil
+}
+
+func nullableString(s plaid.NullableString) string {
+	if v := s.Get(); v != nil {
+		return *v
+	}
+
+	return ""
+}
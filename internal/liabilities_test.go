@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+func testLiabilityAccount(id string, current *float32) plaid.AccountBase {
+	gbp := "GBP"
+	acct := plaid.AccountBase{AccountId: id, Name: id}
+	acct.Balances.IsoCurrencyCode.Set(&gbp)
+	acct.Balances.Current.Set(current)
+	return acct
+}
+
+func float32Ptr(f float32) *float32 {
+	return &f
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestConvertLiabilities(t *testing.T) {
+	accounts := map[string]plaid.AccountBase{
+		"card":     testLiabilityAccount("card", float32Ptr(1234.56)),
+		"mortgage": testLiabilityAccount("mortgage", float32Ptr(150000.1)),
+		"student":  testLiabilityAccount("student", float32Ptr(100000.01)),
+		"no-bal":   testLiabilityAccount("no-bal", nil),
+	}
+
+	card := plaid.CreditCardLiability{
+		Aprs: []plaid.APR{
+			{AprType: "cash_apr", AprPercentage: 29.9},
+			{AprType: "purchase_apr", AprPercentage: 22.9},
+		},
+		MinimumPaymentAmount: 25.5,
+	}
+	card.AccountId.Set(stringPtr("card"))
+	card.NextPaymentDueDate.Set(stringPtr("2024-02-01"))
+
+	mortgage := plaid.MortgageLiability{AccountId: "mortgage"}
+	mortgage.InterestRate.Percentage.Set(float32Ptr(4.25))
+	mortgage.NextMonthlyPayment.Set(float32Ptr(812.34))
+	mortgage.NextPaymentDueDate.Set(stringPtr("2024-02-15"))
+
+	student := plaid.StudentLoan{InterestRatePercentage: 5.5}
+	student.AccountId.Set(stringPtr("student"))
+	student.MinimumPaymentAmount.Set(float32Ptr(100))
+	// float32 arithmetic would leave 99999.984
+	student.OutstandingInterestAmount.Set(float32Ptr(0.02))
+
+	noBalance := plaid.StudentLoan{InterestRatePercentage: 3}
+	noBalance.AccountId.Set(stringPtr("no-bal"))
+	noBalance.OutstandingInterestAmount.Set(float32Ptr(10))
+
+	// credit cards without an account are skipped
+	unlinked := plaid.CreditCardLiability{Aprs: []plaid.APR{{AprType: "purchase_apr", AprPercentage: 19.9}}}
+
+	liabilities, err := convertLiabilities(plaid.LiabilitiesObject{
+		Credit:   []plaid.CreditCardLiability{card, unlinked},
+		Mortgage: []plaid.MortgageLiability{mortgage},
+		Student:  []plaid.StudentLoan{student, noBalance},
+	}, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]liability{
+		"card": {
+			kind:           "Credit Card",
+			apr:            "22.9%",
+			minimumPayment: "25.50 GBP",
+			nextDue:        "2024-02-01",
+			principal:      "1234.56 GBP",
+		},
+		"mortgage": {
+			kind:           "Mortgage",
+			apr:            "4.25%",
+			minimumPayment: "812.34 GBP",
+			nextDue:        "2024-02-15",
+			principal:      "150000.10 GBP",
+		},
+		"student": {
+			kind:           "Student Loan",
+			apr:            "5.5%",
+			minimumPayment: "100.00 GBP",
+			principal:      "99999.99 GBP",
+		},
+		"no-bal": {
+			kind: "Student Loan",
+			apr:  "3%",
+		},
+	}
+
+	if !reflect.DeepEqual(liabilities, expect) {
+		t.Fatalf("mismatch in liabilities\nhave: %+v\nwant: %+v", liabilities, expect)
+	}
+}
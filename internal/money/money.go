@@ -0,0 +1,186 @@
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// defaultExponent is the number of decimal places for currencies not listed in exponents, including no currency
+const defaultExponent = 2
+
+// exponents lists ISO 4217 currencies which don't use two decimal places
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// Amount is an exact amount of money, held as a whole number of the currency's minor units
+type Amount struct {
+	Minor    int64
+	Currency string
+}
+
+// New returns an Amount of minor units of the ISO 4217 currency
+func New(minor int64, currency string) Amount {
+	return Amount{Minor: minor, Currency: currency}
+}
+
+// Exponent returns the number of decimal places used by an ISO 4217 currency
+func Exponent(currency string) int {
+	if exp, ok := exponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+
+	return defaultExponent
+}
+
+// Parse parses a decimal string such as "-1234.567" into an Amount of currency.
+// Digits beyond the currency's minor units are rounded half away from zero.
+func Parse(s, currency string) (Amount, error) {
+	str := strings.TrimSpace(s)
+	neg := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		neg = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	whole, frac, _ := strings.Cut(str, ".")
+	if whole == "" && frac == "" {
+		return Amount{}, fmt.Errorf("invalid amount '%s'", s)
+	}
+
+	exp := Exponent(currency)
+	var roundUp bool
+	if len(frac) > exp {
+		roundUp = frac[exp] >= '5'
+		if strings.Trim(frac[exp:], "0123456789") != "" {
+			return Amount{}, fmt.Errorf("invalid amount '%s'", s)
+		}
+
+		frac = frac[:exp]
+	}
+
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	if digits == "" {
+		// only fractional digits, all dropped by a currency without minor units, such as ".5" JPY
+		digits = "0"
+	}
+
+	if strings.Trim(digits, "0123456789") != "" {
+		return Amount{}, fmt.Errorf("invalid amount '%s'", s)
+	}
+
+	magnitude, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount '%s': %w", s, err)
+	}
+
+	if roundUp {
+		magnitude++
+	}
+
+	// negative amounts can be one minor unit larger than positive ones
+	if magnitude > math.MaxInt64+1 || (!neg && magnitude > math.MaxInt64) || magnitude == 0 && roundUp {
+		return Amount{}, fmt.Errorf("amount '%s' out of range", s)
+	}
+
+	minor := int64(magnitude)
+	if neg {
+		minor = -minor
+	}
+
+	return Amount{Minor: minor, Currency: currency}, nil
+}
+
+// MustParse is like Parse, but panics if s cannot be parsed
+func MustParse(s, currency string) Amount {
+	a, err := Parse(s, currency)
+	if err != nil {
+		panic(err)
+	}
+
+	return a
+}
+
+// FromFloat32 converts a float32 amount, as returned by plaid, to the nearest Amount of currency.
+// The shortest decimal representation of f is used, so 10.26 becomes exactly 10.26, not 10.2600002.
+func FromFloat32(f float32, currency string) (Amount, error) {
+	return Parse(strconv.FormatFloat(float64(f), 'f', -1, 32), currency)
+}
+
+// FromFloat64 converts a float64 amount, such as one from a configuration file, to the nearest Amount of currency
+func FromFloat64(f float64, currency string) (Amount, error) {
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+// String formats the amount with exactly as many decimal places as its currency uses, without the currency
+func (a Amount) String() string {
+	exp := Exponent(a.Currency)
+
+	sign := ""
+	// negate as unsigned, so that math.MinInt64 doesn't overflow
+	magnitude := uint64(a.Minor)
+	if a.Minor < 0 {
+		sign = "-"
+		magnitude = -magnitude
+	}
+
+	digits := strconv.FormatUint(magnitude, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Float64 returns the amount as a float64, which may not be exact, for display or formats which need floats
+func (a Amount) Float64() float64 {
+	return float64(a.Minor) / math.Pow10(Exponent(a.Currency))
+}
+
+// Neg returns the negation of a
+func (a Amount) Neg() Amount {
+	return Amount{Minor: -a.Minor, Currency: a.Currency}
+}
+
+// Add returns a + b, erroring if they are in different currencies
+func (a Amount) Add(b Amount) (Amount, error) {
+	if !strings.EqualFold(a.Currency, b.Currency) {
+		return Amount{}, fmt.Errorf("cannot add %s %s to %s %s", b, b.Currency, a, a.Currency)
+	}
+
+	return Amount{Minor: a.Minor + b.Minor, Currency: a.Currency}, nil
+}
+
+// Percent returns percent% of a, rounded half away from zero to the nearest minor unit
+func (a Amount) Percent(percent float64) Amount {
+	return Amount{Minor: int64(math.Round(float64(a.Minor) * percent / 100)), Currency: a.Currency}
+}
+
+// IsZero returns true if a is zero, in any currency
+func (a Amount) IsZero() bool {
+	return a.Minor == 0
+}
+
+// Sign returns -1 if a is negative, 0 if zero, or 1 if positive
+func (a Amount) Sign() int {
+	switch {
+	case a.Minor < 0:
+		return -1
+	case a.Minor > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,108 @@
+package money
+
+import (
+	"math"
+	"testing"
+	"testing/quick"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		In       string
+		Currency string
+		Expect   Amount
+	}{
+		{In: "10.26", Currency: "GBP", Expect: New(1026, "GBP")},
+		{In: "-5001.67", Currency: "GBP", Expect: New(-500167, "GBP")},
+		{In: "0.005", Currency: "GBP", Expect: New(1, "GBP")},
+		{In: "-0.005", Currency: "GBP", Expect: New(-1, "GBP")},
+		{In: "0.0049", Currency: "GBP", Expect: New(0, "GBP")},
+		{In: "12", Currency: "", Expect: New(1200, "")},
+		{In: "+.5", Currency: "USD", Expect: New(50, "USD")},
+		{In: "1500", Currency: "JPY", Expect: New(1500, "JPY")},
+		{In: "1500.5", Currency: "JPY", Expect: New(1501, "JPY")},
+		{In: ".5", Currency: "JPY", Expect: New(1, "JPY")},
+		{In: "-.5", Currency: "JPY", Expect: New(-1, "JPY")},
+		{In: ".4", Currency: "JPY", Expect: New(0, "JPY")},
+		{In: "1.2345", Currency: "KWD", Expect: New(1235, "KWD")},
+		{In: "99999999999999.99", Currency: "GBP", Expect: New(9999999999999999, "GBP")},
+		{In: "-92233720368547758.08", Currency: "GBP", Expect: New(math.MinInt64, "GBP")},
+	}
+
+	for _, tst := range tests {
+		got, err := Parse(tst.In, tst.Currency)
+		if err != nil {
+			t.Fatalf("failed to parse '%s': %v", tst.In, err)
+		}
+
+		if got != tst.Expect {
+			t.Fatalf("parsing '%s' %s: expected %+v, got %+v", tst.In, tst.Currency, tst.Expect, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{"", "-", "abc", "1.2.3", "1,000", "1e5", "1.0x", "99999999999999999999", "92233720368547758.08"} {
+		if _, err := Parse(in, "GBP"); err == nil {
+			t.Fatalf("expected error parsing '%s'", in)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		In     Amount
+		Expect string
+	}{
+		{In: New(1026, "GBP"), Expect: "10.26"},
+		{In: New(-500167, "GBP"), Expect: "-5001.67"},
+		{In: New(5, "GBP"), Expect: "0.05"},
+		{In: New(-5, "GBP"), Expect: "-0.05"},
+		{In: New(0, "GBP"), Expect: "0.00"},
+		{In: New(1500, "JPY"), Expect: "1500"},
+		{In: New(-1, "KWD"), Expect: "-0.001"},
+		{In: New(math.MinInt64, "GBP"), Expect: "-92233720368547758.08"},
+	}
+
+	for _, tst := range tests {
+		if got := tst.In.String(); got != tst.Expect {
+			t.Fatalf("formatting %+v: expected '%s', got '%s'", tst.In, tst.Expect, got)
+		}
+	}
+}
+
+func TestFromFloat32(t *testing.T) {
+	// 10.26 is not exactly representable, float64(float32(10.26)) is 10.260000228881836
+	got, err := FromFloat32(10.26, "GBP")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := New(1026, "GBP"); got != expect {
+		t.Fatalf("expected %+v, got %+v", expect, got)
+	}
+}
+
+var testCurrencies = []string{"", "GBP", "USD", "JPY", "KWD", "CLF"}
+
+func TestStringParseRoundTrip(t *testing.T) {
+	roundTrip := func(minor int64, currency uint8) bool {
+		a := New(minor, testCurrencies[int(currency)%len(testCurrencies)])
+		parsed, err := Parse(a.String(), a.Currency)
+		return err == nil && parsed == a
+	}
+
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	if got, expect := New(1000, "GBP").Percent(33.3), New(333, "GBP"); got != expect {
+		t.Fatalf("expected %+v, got %+v", expect, got)
+	}
+
+	if got, expect := New(-1001, "GBP").Percent(50), New(-501, "GBP"); got != expect {
+		t.Fatalf("expected %+v, got %+v", expect, got)
+	}
+}
@@ -0,0 +1,283 @@
+package ofx
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// OFX spec: https://financialdataexchange.org/ofx
+
+// Version is the major version of OFX to write: 1 is SGML, 2 is XML
+type Version int
+
+const (
+	Version1 Version = 1
+	Version2 Version = 2
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102150405"
+)
+
+const sgmlHeader = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:103
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+`
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+// Account types for bank statements
+const (
+	Checking    = "CHECKING"
+	Savings     = "SAVINGS"
+	MoneyMarket = "MONEYMRKT"
+	CreditLine  = "CREDITLINE"
+	CD          = "CD"
+)
+
+// Statement is the statement of one account over a date range
+type Statement struct {
+	BankID    string
+	AccountID string
+	// AccountType is one of the bank account types, and is ignored for credit cards
+	AccountType string
+	CreditCard  bool
+	Currency    string
+	Start       time.Time
+	End         time.Time
+	// Transactions amounts are positive when money enters the account, as in OFX
+	Transactions     []Transaction
+	LedgerBalance    *Balance
+	AvailableBalance *Balance
+}
+
+type Transaction struct {
+	Posted time.Time
+	Amount money.Amount
+	// FITID uniquely identifies the transaction, so importers can skip ones they've already seen
+	FITID       string
+	Name        string
+	Memo        string
+	CheckNumber string
+}
+
+type Balance struct {
+	Amount money.Amount
+	AsOf   time.Time
+}
+
+// Writer is not safe for concurrent use
+type Writer struct {
+	w       io.Writer
+	version Version
+	now     func() time.Time
+}
+
+// NewWriter returns a Writer which is not safe for concurrent use
+func NewWriter(w io.Writer, version Version) *Writer {
+	return &Writer{
+		w:       w,
+		version: version,
+		now:     time.Now,
+	}
+}
+
+// element is an OFX aggregate if it has children, or otherwise an element with a value
+type element struct {
+	name     string
+	value    string
+	children []element
+}
+
+func agg(name string, children ...element) element {
+	return element{name: name, children: children}
+}
+
+func el(name, value string) element {
+	return element{name: name, value: value}
+}
+
+// WriteStatements writes a complete OFX document containing all of the statements, which must all have a currency
+func (w *Writer) WriteStatements(statements []Statement) error {
+	var bank, card []element
+	for i, s := range statements {
+		// CURDEF is required
+		if s.Currency == "" {
+			return fmt.Errorf("statement of account '%s' has no currency", s.AccountID)
+		}
+
+		if s.CreditCard {
+			card = append(card, creditCardStatement(i, s))
+		} else {
+			bank = append(bank, bankStatement(i, s))
+		}
+	}
+
+	ofx := agg("OFX", agg("SIGNONMSGSRSV1", agg("SONRS",
+		status(),
+		el("DTSERVER", w.now().UTC().Format(dateTimeFormat)),
+		el("LANGUAGE", "ENG"),
+	)))
+
+	if len(bank) != 0 {
+		ofx.children = append(ofx.children, agg("BANKMSGSRSV1", bank...))
+	}
+
+	if len(card) != 0 {
+		ofx.children = append(ofx.children, agg("CREDITCARDMSGSRSV1", card...))
+	}
+
+	header := sgmlHeader
+	if w.version == Version2 {
+		header = xmlHeader
+	}
+
+	var sb strings.Builder
+	sb.WriteString(header)
+	w.writeElement(&sb, ofx)
+
+	out := []byte(sb.String())
+	if w.version == Version1 {
+		out = windows1252(sb.String())
+	}
+
+	if _, err := w.w.Write(out); err != nil {
+		return fmt.Errorf("failed to write ofx: %w", err)
+	}
+
+	return nil
+}
+
+func status() element {
+	return agg("STATUS", el("CODE", "0"), el("SEVERITY", "INFO"))
+}
+
+func bankStatement(i int, s Statement) element {
+	acctType := s.AccountType
+	if acctType == "" {
+		acctType = Checking
+	}
+
+	from := agg("BANKACCTFROM", el("BANKID", s.BankID), el("ACCTID", s.AccountID), el("ACCTTYPE", acctType))
+	return agg("STMTTRNRS", el("TRNUID", fmt.Sprint(i)), status(), agg("STMTRS", statementBody(s, from)...))
+}
+
+func creditCardStatement(i int, s Statement) element {
+	from := agg("CCACCTFROM", el("ACCTID", s.AccountID))
+	return agg("CCSTMTTRNRS", el("TRNUID", fmt.Sprint(i)), status(), agg("CCSTMTRS", statementBody(s, from)...))
+}
+
+func statementBody(s Statement, from element) []element {
+	list := agg("BANKTRANLIST", el("DTSTART", s.Start.Format(dateFormat)), el("DTEND", s.End.Format(dateFormat)))
+	for _, tx := range s.Transactions {
+		list.children = append(list.children, transaction(tx))
+	}
+
+	body := []element{el("CURDEF", strings.ToUpper(s.Currency)), from, list}
+	if s.LedgerBalance != nil {
+		body = append(body, balance("LEDGERBAL", *s.LedgerBalance))
+	}
+
+	if s.AvailableBalance != nil {
+		body = append(body, balance("AVAILBAL", *s.AvailableBalance))
+	}
+
+	return body
+}
+
+func transaction(tx Transaction) element {
+	trnType := "CREDIT"
+	if tx.Amount.Sign() < 0 {
+		trnType = "DEBIT"
+	}
+
+	return agg("STMTTRN",
+		el("TRNTYPE", trnType),
+		el("DTPOSTED", tx.Posted.Format(dateFormat)),
+		el("TRNAMT", tx.Amount.String()),
+		el("FITID", tx.FITID),
+		el("CHECKNUM", tx.CheckNumber),
+		el("NAME", truncate(tx.Name, 32)),
+		el("MEMO", tx.Memo),
+	)
+}
+
+func balance(name string, b Balance) element {
+	return agg(name, el("BALAMT", b.Amount.String()), el("DTASOF", b.AsOf.Format(dateFormat)))
+}
+
+// truncate shortens s to at most n runes, as OFX limits the length of some elements
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n])
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (w *Writer) writeElement(sb *strings.Builder, e element) {
+	if e.children == nil {
+		// optional elements are left out entirely when empty
+		if e.value == "" {
+			return
+		}
+
+		sb.WriteString("<" + e.name + ">" + escaper.Replace(e.value))
+		// OFX 1 is SGML, where elements with values have no closing tag
+		if w.version == Version2 {
+			sb.WriteString("</" + e.name + ">")
+		}
+
+		sb.WriteString("\n")
+		return
+	}
+
+	sb.WriteString("<" + e.name + ">\n")
+	for _, child := range e.children {
+		w.writeElement(sb, child)
+	}
+
+	sb.WriteString("</" + e.name + ">\n")
+}
+
+// windows1252Extras are the characters windows-1252 has in place of the C1 control characters of latin-1
+var windows1252Extras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A,
+	'‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// windows1252 encodes s as the CHARSET of the OFX 1 header, replacing characters it doesn't have with '?'
+func windows1252(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch b, ok := windows1252Extras[r]; {
+		case ok:
+			out = append(out, b)
+		case r < 0x80 || r >= 0xA0 && r <= 0xFF:
+			// windows-1252 is latin-1 everywhere else, which is the first 256 code points of unicode
+			out = append(out, byte(r))
+		default:
+			out = append(out, '?')
+		}
+	}
+
+	return out
+}
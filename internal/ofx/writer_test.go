@@ -0,0 +1,112 @@
+package ofx
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func testStatements() []Statement {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	return []Statement{
+		{
+			BankID:      "testBank",
+			AccountID:   "acct-current",
+			AccountType: Checking,
+			Currency:    "gbp",
+			Start:       start,
+			End:         end,
+			Transactions: []Transaction{
+				{
+					Posted:      time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+					Amount:      money.MustParse("-10.26", "GBP"),
+					FITID:       "tx-1",
+					Name:        "Marks & Spencer <Food>",
+					Memo:        "Pending",
+					CheckNumber: "1042",
+				},
+				{
+					Posted: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+					Amount: money.MustParse("5001.67", "GBP"),
+					FITID:  "tx-2",
+					Name:   "A payee name which is much too long for ofx",
+				},
+			},
+			LedgerBalance:    &Balance{Amount: money.MustParse("1234.56", "GBP"), AsOf: end},
+			AvailableBalance: &Balance{Amount: money.MustParse("1200", "GBP"), AsOf: end},
+		},
+		{
+			AccountID:  "acct-card",
+			CreditCard: true,
+			Currency:   "GBP",
+			Start:      start,
+			End:        end,
+			Transactions: []Transaction{
+				{
+					Posted: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+					Amount: money.MustParse("-1.50", "GBP"),
+					FITID:  "tx-3",
+					Name:   "Café – 1,50€",
+					// windows-1252 has no kanji, so they're replaced in OFX 1
+					Memo: "珈琲",
+				},
+			},
+			LedgerBalance: &Balance{Amount: money.MustParse("-1.50", "GBP"), AsOf: end},
+		},
+	}
+}
+
+func TestWriteStatements(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Version Version
+	}{
+		{Name: "v1.ofx", Version: Version1},
+		{Name: "v2.ofx", Version: Version2},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewWriter(&out, tst.Version)
+			w.now = func() time.Time { return time.Date(2020, 2, 1, 12, 30, 0, 0, time.UTC) }
+
+			if err := w.WriteStatements(testStatements()); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tst.Name)
+			if *updateGolden {
+				if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.String(); got != string(expect) {
+				t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+			}
+		})
+	}
+
+	noCurrency := testStatements()
+	noCurrency[1].Currency = ""
+	if err := NewWriter(io.Discard, Version1).WriteStatements(noCurrency); err == nil {
+		t.Fatal("expected error writing statement without a currency, as CURDEF is required")
+	}
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/ofx"
+)
+
+var plaidToOFXAccountType = map[plaid.AccountSubtype]string{
+	plaid.ACCOUNTSUBTYPE_CHECKING:     ofx.Checking,
+	plaid.ACCOUNTSUBTYPE_SAVINGS:      ofx.Savings,
+	plaid.ACCOUNTSUBTYPE_MONEY_MARKET: ofx.MoneyMarket,
+	plaid.ACCOUNTSUBTYPE_CD:           ofx.CD,
+}
+
+// ofxFile collects the statements of every account written to an OFX file, as OFX files can't be appended to
+type ofxFile struct {
+	path       string
+	statements []*ofx.Statement
+}
+
+// ofxFiles builds an OFX statement for each account, writing them all out on Close, one file per account
+// unless combining them. ofxFiles is not safe for concurrent use.
+type ofxFiles struct {
+	opts       OutputOptions
+	version    ofx.Version
+	from       time.Time
+	until      time.Time
+	files      map[string]*ofxFile
+	statements map[string]*ofx.Statement
+	order      []string
+}
+
+func newOFXFiles(opts OutputOptions, version ofx.Version, from, until time.Time) (*ofxFiles, error) {
+	opts, err := validateOutputOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ofxFiles{
+		opts:       opts,
+		version:    version,
+		from:       from,
+		until:      until,
+		files:      make(map[string]*ofxFile),
+		statements: make(map[string]*ofx.Statement),
+	}, nil
+}
+
+func (o *ofxFiles) destination(institution string, acct plaid.AccountBase) string {
+	path, _ := outputPath(o.opts, institution, acct, "ofx")
+	return path
+}
+
+func (o *ofxFiles) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	s, ok := o.statements[acct.AccountId]
+	if !ok {
+		var err error
+		s, err = o.newStatement(institution, acct)
+		if err != nil {
+			return err
+		}
+
+		// CURDEF is required, so accounts plaid gives no currency take their transactions'
+		if s.Currency == "" {
+			s.Currency = transactions[0].original.Currency
+		}
+
+		if s.Currency == "" {
+			return fmt.Errorf("cannot write account '%s' without a currency to ofx", acct.Name)
+		}
+
+		path, _ := outputPath(o.opts, institution, acct, "ofx")
+		of, ok := o.files[path]
+		if !ok {
+			of = &ofxFile{path: path}
+			o.files[path] = of
+			o.order = append(o.order, path)
+		}
+
+		of.statements = append(of.statements, s)
+		o.statements[acct.AccountId] = s
+	}
+
+	for _, tx := range transactions {
+		s.Transactions = append(s.Transactions, ofx.Transaction{
+			Posted: tx.Date,
+			// OFX amounts are positive when money enters the account, the opposite of plaid, and are in the
+			// currency of the statement, so are never converted to the reporting currency
+			Amount:      tx.original.Neg(),
+			FITID:       tx.source.TransactionId,
+			Name:        tx.Payee,
+			Memo:        tx.Memo,
+			CheckNumber: tx.Number,
+		})
+	}
+
+	return nil
+}
+
+func (o *ofxFiles) newStatement(institution string, acct plaid.AccountBase) (*ofx.Statement, error) {
+	s := &ofx.Statement{
+		// plaid doesn't give us routing numbers, but BANKID is required
+		BankID:    institution,
+		AccountID: acct.AccountId,
+		Currency:  currencyCode(acct.Balances.IsoCurrencyCode, acct.Balances.UnofficialCurrencyCode),
+		Start:     o.from,
+		End:       o.until,
+	}
+
+	switch acct.Type {
+	case plaid.ACCOUNTTYPE_CREDIT:
+		s.CreditCard = true
+	case plaid.ACCOUNTTYPE_LOAN:
+		s.AccountType = ofx.CreditLine
+	case plaid.ACCOUNTTYPE_DEPOSITORY:
+		if subtype := acct.Subtype.Get(); subtype != nil {
+			s.AccountType = plaidToOFXAccountType[*subtype]
+		}
+	default:
+		return nil, fmt.Errorf("cannot write plaid account type '%s' to ofx", acct.Type)
+	}
+
+	asOf := o.until
+	if updated := acct.Balances.LastUpdatedDatetime.Get(); updated != nil {
+		asOf = *updated
+	}
+
+	var err error
+	if s.LedgerBalance, err = ofxBalance(acct, acct.Balances.Current, asOf); err != nil {
+		return nil, fmt.Errorf("failed to convert current balance of account '%s': %w", acct.Name, err)
+	}
+
+	if s.AvailableBalance, err = ofxBalance(acct, acct.Balances.Available, asOf); err != nil {
+		return nil, fmt.Errorf("failed to convert available balance of account '%s': %w", acct.Name, err)
+	}
+
+	return s, nil
+}
+
+// ofxBalance returns nil if plaid has no balance. Plaid balances of credit and loan accounts are positive
+// when money is owed, but OFX balances are always negative when money is owed.
+func ofxBalance(acct plaid.AccountBase, balance plaid.NullableFloat32, asOf time.Time) (*ofx.Balance, error) {
+	b := balance.Get()
+	if b == nil {
+		return nil, nil
+	}
+
+	currency := currencyCode(acct.Balances.IsoCurrencyCode, acct.Balances.UnofficialCurrencyCode)
+	amount, err := money.FromFloat32(*b, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLiabilityAccount(acct) {
+		amount = amount.Neg()
+	}
+
+	return &ofx.Balance{Amount: amount, AsOf: asOf}, nil
+}
+
+// Close writes out every OFX file, returning the first error encountered
+func (o *ofxFiles) Close() error {
+	var firstErr error
+	for _, path := range o.order {
+		if err := o.writeFile(o.files[path]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	o.files = make(map[string]*ofxFile)
+	o.statements = make(map[string]*ofx.Statement)
+	o.order = nil
+	return firstErr
+}
+
+func (o *ofxFiles) writeFile(of *ofxFile) error {
+	f, err := files.OpenWriter(of.path, "ofx")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	statements := make([]ofx.Statement, 0, len(of.statements))
+	for _, s := range of.statements {
+		statements = append(statements, *s)
+	}
+
+	if err := ofx.NewWriter(f, o.version).WriteStatements(statements); err != nil {
+		return fmt.Errorf("failed to write ofx file '%s': %w", of.path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close ofx file '%s': %w", of.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/ofx"
+	"github.com/chill/plaidqif/internal/pendingmode"
+	"github.com/chill/plaidqif/internal/plaintext"
+	"github.com/chill/plaidqif/internal/qif"
+	"github.com/chill/plaidqif/internal/statement"
+)
+
+// Ways of combining accounts into QIF files
+const (
+	CombineNone        = "none"
+	CombineInstitution = "institution"
+	CombineAll         = "all"
+)
+
+// CombineModes lists the valid values for OutputOptions.Combine
+var CombineModes = []string{CombineNone, CombineInstitution, CombineAll}
+
+// Formats to write transactions in
+const (
+	FormatQIF       = "qif"
+	FormatOFX1      = "ofx1"
+	FormatOFX2      = "ofx2"
+	FormatBeancount = "beancount"
+	FormatLedger    = "ledger"
+	FormatCSV       = "csv"
+	FormatJSONL     = "jsonl"
+	FormatGnuCash   = "gnucash"
+	FormatCamt053   = "camt053"
+	FormatMT940     = "mt940"
+)
+
+// Formats lists the valid values for OutputOptions.Format
+var Formats = []string{FormatQIF, FormatOFX1, FormatOFX2, FormatBeancount, FormatLedger, FormatCSV, FormatJSONL, FormatGnuCash, FormatCamt053, FormatMT940}
+
+// combinedName is the name, without extension, of the file holding every account, when combining all of them
+const combinedName = "plaidqif"
+
+// OutputOptions control where and how transactions are written
+type OutputOptions struct {
+	OutDir string
+	// Combine is one of CombineModes
+	Combine string
+	// Format is one of Formats, and defaults to QIF
+	Format string
+	// IncludeExported writes transactions again which were already written by an earlier run
+	IncludeExported bool
+	// TransferDays is how many days apart transfers between accounts can be dated, or negative to not match them
+	TransferDays int
+	// Pending is one of pendingmode.Modes, overriding the default pending mode of accounts when set
+	Pending string
+	// pendingFiles writes to the files of pending transactions, which are named <name>.pending.<ext>
+	pendingFiles bool
+	// stamp is added to file names as <name>.<stamp>.<ext> when set, so runs don't overwrite each other's files
+	stamp string
+}
+
+// transaction is a plaid transaction converted to QIF, along with the plaid transaction it came from,
+// for formats which need more than QIF can hold
+type transaction struct {
+	qif.Transaction
+	source plaid.Transaction
+	// transfer is the other account of a transaction matched as a transfer between accounts, or nil
+	transfer *transferAccount
+	// original is the amount in the account's own currency, which differs from Amount if that was converted
+	// to the reporting currency
+	original money.Amount
+}
+
+// exporter writes accounts' transactions to files in some format. Nothing is guaranteed to be written until Close.
+type exporter interface {
+	writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error
+	// destination is the file, or book, an account's transactions are written to
+	destination(institution string, acct plaid.AccountBase) string
+	Close() error
+}
+
+// newExporter returns the exporter for opts.Format, writing transactions downloaded between from and until,
+// and skipping transactions already written by an earlier run unless opts.IncludeExported is set
+func (p *PlaidQIF) newExporter(opts OutputOptions, from, until time.Time) (exporter, error) {
+	modes, err := p.pendingModes.WithDefault(pendingmode.Mode(opts.Pending))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := p.newFormatExporter(opts, from, until)
+	if err != nil {
+		return nil, err
+	}
+
+	// gnucash books never hold pending transactions, and there's no separate book to write them to, so they're left out
+	// before they could be recorded as exported to the book
+	if opts.Format == FormatGnuCash {
+		modes = pendingmode.Config{Default: pendingmode.Exclude}
+	}
+
+	settled := p.newExportedFilter(opts, out)
+	newPending := func() (exporter, error) {
+		pendingOpts := opts
+		pendingOpts.pendingFiles = true
+		out, err := p.newFormatExporter(pendingOpts, from, until)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.newExportedFilter(opts, out), nil
+	}
+
+	return newPendingSplitter(settled, newPending, modes), nil
+}
+
+// newExportedFilter skips transactions written by earlier runs, except in bank statements, which cover every entry
+// of their period so that their opening balance can be worked out from their closing balance
+func (p *PlaidQIF) newExportedFilter(opts OutputOptions, out exporter) exporter {
+	if opts.Format == FormatCamt053 || opts.Format == FormatMT940 {
+		return out
+	}
+
+	return newExportedFilter(out, p.institutions, opts.IncludeExported)
+}
+
+func (p *PlaidQIF) newFormatExporter(opts OutputOptions, from, until time.Time) (exporter, error) {
+	switch opts.Format {
+	case "", FormatQIF:
+		return newQIFFiles(opts, p.dateFormat)
+	case FormatOFX1:
+		return newOFXFiles(opts, ofx.Version1, from, until)
+	case FormatOFX2:
+		return newOFXFiles(opts, ofx.Version2, from, until)
+	case FormatBeancount:
+		return newPlaintextFiles(opts, plaintext.Beancount, p.accountPaths, until)
+	case FormatLedger:
+		return newPlaintextFiles(opts, plaintext.Ledger, p.accountPaths, until)
+	case FormatCSV, FormatJSONL:
+		return newTabularFiles(opts, p.csvTemplate, p.dateFormat)
+	case FormatGnuCash:
+		return newGnuCashBook(p.gnucash)
+	case FormatCamt053:
+		return newStatementFiles(opts, statement.Camt053, from, until)
+	case FormatMT940:
+		return newStatementFiles(opts, statement.MT940, from, until)
+	default:
+		return nil, fmt.Errorf("unknown output format '%s'", opts.Format)
+	}
+}
+
+func validateOutputOptions(opts OutputOptions) (OutputOptions, error) {
+	if err := files.IsExistingDir(opts.OutDir); err != nil {
+		return OutputOptions{}, fmt.Errorf("outdir: %w", err)
+	}
+
+	switch opts.Combine {
+	case "":
+		opts.Combine = CombineNone
+	case CombineNone, CombineInstitution, CombineAll:
+	default:
+		return OutputOptions{}, fmt.Errorf("unknown way to combine accounts '%s'", opts.Combine)
+	}
+
+	return opts, nil
+}
+
+// outputPath returns the path of the file to write an account to, and the name of the account within it
+func outputPath(opts OutputOptions, institution string, acct plaid.AccountBase, ext string) (string, string) {
+	var filename, accountName string
+	switch opts.Combine {
+	case CombineAll:
+		// account names are only unique within an institution
+		filename, accountName = fmt.Sprintf("%s.%s", combinedName, ext), fmt.Sprintf("%s %s", institution, acct.Name)
+	case CombineInstitution:
+		filename, accountName = fmt.Sprintf("%s.%s", institution, ext), acct.Name
+	default:
+		filename, accountName = fmt.Sprintf("%s_%s.%s", institution, acct.Name, ext), acct.Name
+	}
+
+	if opts.stamp != "" {
+		filename = strings.TrimSuffix(filename, "."+ext) + "." + opts.stamp + "." + ext
+	}
+
+	if opts.pendingFiles {
+		filename = strings.TrimSuffix(filename, "."+ext) + ".pending." + ext
+	}
+
+	return filepath.Join(opts.OutDir, filename), accountName
+}
+
+type qifFile struct {
+	path string
+	f    *os.File
+	w    *qif.Writer
+}
+
+// qifFiles opens QIF files for accounts as they are needed, sharing files between accounts when combining them.
+// qifFiles is not safe for concurrent use.
+type qifFiles struct {
+	opts       OutputOptions
+	dateFormat string
+	files      map[string]*qifFile
+	order      []string
+}
+
+func newQIFFiles(opts OutputOptions, dateFormat string) (*qifFiles, error) {
+	opts, err := validateOutputOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &qifFiles{
+		opts:       opts,
+		dateFormat: dateFormat,
+		files:      make(map[string]*qifFile),
+	}, nil
+}
+
+// writer returns the writer for an account, opening its file if necessary and switching to the account
+func (q *qifFiles) writer(institution string, acct plaid.AccountBase) (*qif.Writer, error) {
+	qifType, ok := plaidToQIFType[acct.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown plaid account type '%s'", acct.Type)
+	}
+
+	path, accountName := outputPath(q.opts, institution, acct, "qif")
+	qf, ok := q.files[path]
+	if !ok {
+		f, err := files.OpenWriter(path, "qif")
+		if err != nil {
+			return nil, err
+		}
+
+		qf = &qifFile{path: path, f: f}
+		if q.opts.Combine == CombineNone {
+			qf.w = qif.NewWriter(f, accountName, qifType, q.dateFormat)
+		} else {
+			qf.w = qif.NewAutoSwitchWriter(f, q.dateFormat)
+		}
+
+		q.files[path] = qf
+		q.order = append(q.order, path)
+	}
+
+	qf.w.SwitchAccount(accountName, qifType)
+	return qf.w, nil
+}
+
+func (q *qifFiles) destination(institution string, acct plaid.AccountBase) string {
+	path, _ := outputPath(q.opts, institution, acct, "qif")
+	return path
+}
+
+func (q *qifFiles) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	w, err := q.writer(institution, acct)
+	if err != nil {
+		return err
+	}
+
+	qifTransactions := make([]qif.Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx.transfer != nil {
+			_, accountName := outputPath(q.opts, tx.transfer.institution, tx.transfer.acct, "qif")
+			tx.Category = "[" + accountName + "]"
+		}
+
+		qifTransactions = append(qifTransactions, tx.Transaction)
+	}
+
+	if err := w.WriteTransactions(qifTransactions); err != nil {
+		return fmt.Errorf("failed to write transactions to qif writer: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes every file opened, returning the first error encountered
+func (q *qifFiles) Close() error {
+	var firstErr error
+	for _, path := range q.order {
+		qf := q.files[path]
+		if err := qf.f.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close qif file '%s': %w", qf.path, err)
+		}
+	}
+
+	q.files = make(map[string]*qifFile)
+	q.order = nil
+	return firstErr
+}
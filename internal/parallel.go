@@ -0,0 +1,34 @@
+package internal
+
+import "sync"
+
+// inParallel calls work with every index from 0 to n-1, on a pool of at most parallel workers,
+// returning once every call has. Each call should only write to its own index of any results.
+func inParallel(parallel, n int, work func(i int)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	if parallel > n {
+		parallel = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				work(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInParallel(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Parallel int
+		N        int
+		// MaxWorkers is the most calls expected to run at once
+		MaxWorkers int32
+	}{
+		{Name: "Sequential", Parallel: 1, N: 5, MaxWorkers: 1},
+		{Name: "NoParallelism", Parallel: 0, N: 5, MaxWorkers: 1},
+		{Name: "Pool", Parallel: 3, N: 10, MaxWorkers: 3},
+		{Name: "MoreWorkersThanWork", Parallel: 8, N: 2, MaxWorkers: 2},
+		{Name: "NoWork", Parallel: 4, N: 0},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			calls := make([]int32, tst.N)
+			var running, most int32
+			inParallel(tst.Parallel, tst.N, func(i int) {
+				now := atomic.AddInt32(&running, 1)
+				for {
+					prev := atomic.LoadInt32(&most)
+					if now <= prev || atomic.CompareAndSwapInt32(&most, prev, now) {
+						break
+					}
+				}
+
+				// give the other workers time to start, so too many running at once would be seen
+				time.Sleep(time.Millisecond)
+				calls[i]++
+				atomic.AddInt32(&running, -1)
+			})
+
+			for i, c := range calls {
+				if c != 1 {
+					t.Fatalf("mismatch in calls with index %d\nhave: %d\nwant: 1", i, c)
+				}
+			}
+
+			if most > tst.MaxWorkers {
+				t.Fatalf("too many calls at once\nhave: %d\nwant: at most %d", most, tst.MaxWorkers)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/store"
+)
+
+// Ways a previously exported pending transaction can have changed
+const (
+	pendingReplaced      = "Replaced"
+	pendingAmountChanged = "Amount Changed"
+	pendingVanished      = "Vanished"
+)
+
+// pendingReconciliation is a row of the pending reconciliation report
+type pendingReconciliation struct {
+	change        string
+	institution   string
+	account       string
+	pending       plaid.Transaction
+	pendingAmount money.Amount
+	posted        *plaid.Transaction
+	postedAmount  money.Amount
+	exportedTo    string
+}
+
+// printPendingReconciliation lists pending transactions exported by earlier runs which have since posted as another
+// transaction, posted for a different amount, or vanished, so they can be fixed by hand. Each is only listed once.
+func (p *PlaidQIF) printPendingReconciliation(institutions []institutions.Institution) error {
+	rows, err := p.reconcileExportedPending(institutions)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Exported Pending Transactions:")
+	fmt.Fprintln(tw, "Change\tInstitution\tAccount\tDate\tPayee\tAmount\tPosted Date\tPosted Amount\tExported To\t")
+	fmt.Fprintln(tw, "------\t-----------\t-------\t----\t-----\t------\t-----------\t-------------\t-----------\t")
+
+	for _, r := range rows {
+		var postedDate, postedAmount string
+		if r.posted != nil {
+			postedDate, postedAmount = r.posted.Date, r.postedAmount.String()
+		}
+
+		fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t", r.change, r.institution, r.account,
+			r.pending.Date, r.pending.Name, r.pendingAmount, postedDate, postedAmount, r.exportedTo))
+	}
+
+	return nil
+}
+
+// reconcileExportedPending returns how the exported pending transactions of the institutions have changed since they
+// were last reported, marking every changed pending transaction as reported, exported or not
+func (p *PlaidQIF) reconcileExportedPending(institutions []institutions.Institution) ([]pendingReconciliation, error) {
+	var rows []pendingReconciliation
+	for _, ins := range institutions {
+		accounts, err := p.store.Accounts(ins.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, acct := range accounts {
+			changes, err := p.store.PendingChanges(acct.AccountId)
+			if err != nil {
+				return nil, err
+			}
+
+			reported := make([]string, 0, len(changes))
+			for _, c := range changes {
+				reported = append(reported, c.Pending.TransactionId)
+
+				// pending transactions that were never exported don't need fixing
+				exportedTo, ok := p.institutions.ExportedTo(ins.Name, c.Pending.TransactionId)
+				if !ok {
+					continue
+				}
+
+				row, err := reconcilePending(ins.Name, acct.Name, c, exportedTo)
+				if err != nil {
+					return nil, err
+				}
+
+				rows = append(rows, row)
+			}
+
+			if err := p.store.MarkReported(reported); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// reconcilePending works out how a pending transaction changed, with amounts positive when money enters the account
+func reconcilePending(institution, account string, c store.PendingChange, exportedTo string) (pendingReconciliation, error) {
+	r := pendingReconciliation{
+		change:      pendingVanished,
+		institution: institution,
+		account:     account,
+		pending:     c.Pending,
+		posted:      c.Posted,
+		exportedTo:  exportedTo,
+	}
+
+	var err error
+	currency := currencyCode(c.Pending.IsoCurrencyCode, c.Pending.UnofficialCurrencyCode)
+	if r.pendingAmount, err = money.FromFloat32(-c.Pending.Amount, currency); err != nil {
+		return r, fmt.Errorf("failed to convert pending transaction '%s' amount: %w", c.Pending.TransactionId, err)
+	}
+
+	if c.Posted == nil {
+		return r, nil
+	}
+
+	currency = currencyCode(c.Posted.IsoCurrencyCode, c.Posted.UnofficialCurrencyCode)
+	if r.postedAmount, err = money.FromFloat32(-c.Posted.Amount, currency); err != nil {
+		return r, fmt.Errorf("failed to convert posted transaction '%s' amount: %w", c.Posted.TransactionId, err)
+	}
+
+	r.change = pendingReplaced
+	if r.postedAmount != r.pendingAmount {
+		r.change = pendingAmountChanged
+	}
+
+	return r, nil
+}
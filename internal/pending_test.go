@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/store"
+)
+
+func testPendingTransaction(id, date string, amount float32) plaid.Transaction {
+	tx := testTransfer(id, "current", date, amount, "")
+	tx.Pending = true
+	return tx
+}
+
+func testPostedTransaction(id, pendingID, date string, amount float32) plaid.Transaction {
+	tx := testTransfer(id, "current", date, amount, "")
+	tx.PendingTransactionId.Set(&pendingID)
+	return tx
+}
+
+func TestReconcilePending(t *testing.T) {
+	euro := testPostedTransaction("tx-1", "pending-1", "2020-01-03", 10.26)
+	euro.IsoCurrencyCode.Set(stringPtr("EUR"))
+
+	tests := []struct {
+		Name          string
+		Pending       plaid.Transaction
+		Posted        plaid.Transaction
+		Vanished      bool
+		Change        string
+		PendingAmount money.Amount
+		PostedAmount  money.Amount
+	}{
+		{
+			Name:          "Replaced",
+			Pending:       testPendingTransaction("pending-1", "2020-01-02", 10.26),
+			Posted:        testPostedTransaction("tx-1", "pending-1", "2020-01-03", 10.26),
+			Change:        pendingReplaced,
+			PendingAmount: money.MustParse("-10.26", "GBP"),
+			PostedAmount:  money.MustParse("-10.26", "GBP"),
+		},
+		{
+			Name:          "ReplacedRefund",
+			Pending:       testPendingTransaction("pending-1", "2020-01-02", -5),
+			Posted:        testPostedTransaction("tx-1", "pending-1", "2020-01-03", -5),
+			Change:        pendingReplaced,
+			PendingAmount: money.MustParse("5", "GBP"),
+			PostedAmount:  money.MustParse("5", "GBP"),
+		},
+		{
+			Name:          "AmountChanged",
+			Pending:       testPendingTransaction("pending-1", "2020-01-02", 10.26),
+			Posted:        testPostedTransaction("tx-1", "pending-1", "2020-01-03", 12.5),
+			Change:        pendingAmountChanged,
+			PendingAmount: money.MustParse("-10.26", "GBP"),
+			PostedAmount:  money.MustParse("-12.50", "GBP"),
+		},
+		{
+			Name:          "CurrencyChanged",
+			Pending:       testPendingTransaction("pending-1", "2020-01-02", 10.26),
+			Posted:        euro,
+			Change:        pendingAmountChanged,
+			PendingAmount: money.MustParse("-10.26", "GBP"),
+			PostedAmount:  money.MustParse("-10.26", "EUR"),
+		},
+		{
+			Name:          "Vanished",
+			Pending:       testPendingTransaction("pending-1", "2020-01-02", 10.26),
+			Vanished:      true,
+			Change:        pendingVanished,
+			PendingAmount: money.MustParse("-10.26", "GBP"),
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			c := store.PendingChange{Pending: tst.Pending}
+			if !tst.Vanished {
+				c.Posted = &tst.Posted
+			}
+
+			r, err := reconcilePending("bank", "Current", c, "bank_Current.qif")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.change != tst.Change {
+				t.Fatalf("mismatch in change\nhave: %s\nwant: %s", r.change, tst.Change)
+			}
+
+			if r.pendingAmount != tst.PendingAmount || r.postedAmount != tst.PostedAmount {
+				t.Fatalf("mismatch in amounts\nhave: %v, %v\nwant: %v, %v", r.pendingAmount, r.postedAmount,
+					tst.PendingAmount, tst.PostedAmount)
+			}
+
+			if r.institution != "bank" || r.account != "Current" || r.exportedTo != "bank_Current.qif" {
+				t.Fatalf("mismatch in account\nhave: %s %s, %s\nwant: bank Current, bank_Current.qif", r.institution,
+					r.account, r.exportedTo)
+			}
+		})
+	}
+}
+
+func TestReconcileExportedPending_ReportedOnce(t *testing.T) {
+	p := testPlaidQIF(t)
+
+	// only pending transactions which were exported are listed
+	conf := t.TempDir()
+	if err := os.WriteFile(filepath.Join(conf, "institutions.json"), []byte(`{"bank": {"Name": "bank", "Exported": {
+		"pending-1": "bank_Current.qif", "pending-2": "bank_Current.qif", "pending-3": "bank_Current.qif"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if p.institutions, err = institutions.NewInstitutionManager(conf, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.store.PutAccounts("bank", []plaid.AccountBase{
+		{AccountId: "current", Name: "Current", Type: plaid.ACCOUNTTYPE_DEPOSITORY},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.store.PutTransactions("bank", []plaid.Transaction{
+		testPendingTransaction("pending-1", "2020-01-01", 10.26),
+		testPendingTransaction("pending-2", "2020-01-02", 10.26),
+		testPendingTransaction("pending-3", "2020-01-03", 10.26),
+		testPendingTransaction("pending-4", "2020-01-04", 10.26),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// pending-1 posts, pending-2 posts for a different amount, and pending-3 and pending-4 vanish
+	posted := []plaid.Transaction{
+		testPostedTransaction("tx-1", "pending-1", "2020-01-02", 10.26),
+		testPostedTransaction("tx-2", "pending-2", "2020-01-03", 12.5),
+	}
+
+	if err := p.store.PutTransactions("bank", posted); err != nil {
+		t.Fatal(err)
+	}
+
+	from, until := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	if err := p.store.RemoveMissing("current", from, until, []string{"tx-1", "tx-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	insts := p.institutions.List()
+	rows, err := p.reconcileExportedPending(insts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	for _, r := range rows {
+		changes = append(changes, r.pending.TransactionId+" "+r.change)
+	}
+
+	expect := []string{"pending-1 " + pendingReplaced, "pending-2 " + pendingAmountChanged, "pending-3 " + pendingVanished}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Fatalf("mismatch in pending changes\nhave: %v\nwant: %v", changes, expect)
+	}
+
+	if rows, err = p.reconcileExportedPending(insts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 0 {
+		t.Fatalf("expected pending changes not to be listed again, got: %+v", rows)
+	}
+
+	// pending transactions which were never exported are marked as reported too, so aren't looked at again
+	left, err := p.store.PendingChanges("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(left) != 0 {
+		t.Fatalf("expected every pending change to be marked as reported, got: %+v", left)
+	}
+}
@@ -0,0 +1,99 @@
+package pendingmode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chill/plaidqif/internal/files"
+)
+
+// Mode is what to do with the pending transactions of an account
+type Mode string
+
+const (
+	// Include writes pending transactions along with settled ones
+	Include Mode = "include"
+	// Exclude leaves pending transactions out
+	Exclude Mode = "exclude"
+	// Separate writes pending transactions to their own file, alongside the file of settled ones
+	Separate Mode = "separate"
+)
+
+// Modes lists the valid modes
+var Modes = []string{string(Include), string(Exclude), string(Separate)}
+
+// Config is the pending mode of each account
+type Config struct {
+	// Default is the mode of accounts with no mode of their own, and defaults to Include
+	Default Mode
+	// Accounts maps "<institution>/<account name>" to the mode of a plaid account
+	Accounts map[string]Mode
+}
+
+// LoadConfig assumes confDir already exists. If there is no pending config file,
+// the returned Config includes pending transactions of every account.
+func LoadConfig(confDir, filename string) (Config, error) {
+	if filename == "" {
+		filename = "pending.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var c Config
+	err := files.Unmarshal(path, "pending", &c)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return Config{}, err
+	}
+
+	if c.Default != "" {
+		if err := c.Default.validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid default in pending file '%s': %w", path, err)
+		}
+	}
+
+	for account, m := range c.Accounts {
+		if err := m.validate(); err != nil {
+			return Config{}, fmt.Errorf("invalid mode of account '%s' in pending file '%s': %w", account, path, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (m Mode) validate() error {
+	switch m {
+	case Include, Exclude, Separate:
+		return nil
+	default:
+		return fmt.Errorf("unknown pending mode '%s'", m)
+	}
+}
+
+// WithDefault returns a copy of c with a different default mode, leaving c unchanged if m is empty
+func (c Config) WithDefault(m Mode) (Config, error) {
+	if m == "" {
+		return c, nil
+	}
+
+	if err := m.validate(); err != nil {
+		return Config{}, err
+	}
+
+	c.Default = m
+	return c, nil
+}
+
+// Mode returns the mode of a plaid account
+func (c Config) Mode(institution, account string) Mode {
+	if m, ok := c.Accounts[institution+"/"+account]; ok {
+		return m
+	}
+
+	if c.Default == "" {
+		return Include
+	}
+
+	return c.Default
+}
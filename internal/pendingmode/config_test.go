@@ -0,0 +1,61 @@
+package pendingmode
+
+import (
+	"testing"
+)
+
+func TestConfig_Mode(t *testing.T) {
+	c, err := LoadConfig("./", "test_pending.json")
+	if err != nil {
+		t.Fatalf("failed to load pending config: %v", err)
+	}
+
+	missing, err := LoadConfig("./", "test_missing_pending.json")
+	if err != nil {
+		t.Fatalf("failed to load missing pending config: %v", err)
+	}
+
+	overridden, err := c.WithDefault(Include)
+	if err != nil {
+		t.Fatalf("failed to override default pending mode: %v", err)
+	}
+
+	tests := []struct {
+		Name        string
+		Config      Config
+		Institution string
+		Account     string
+		Expect      Mode
+	}{
+		{Name: "Account", Config: c, Institution: "monzo", Account: "Current Account", Expect: Separate},
+		{Name: "AccountInclude", Config: c, Institution: "amex", Account: "Gold", Expect: Include},
+		{Name: "Default", Config: c, Institution: "monzo", Account: "Savings", Expect: Exclude},
+		{Name: "OverriddenDefault", Config: overridden, Institution: "monzo", Account: "Savings", Expect: Include},
+		{Name: "OverriddenDefaultKeepsAccounts", Config: overridden, Institution: "monzo", Account: "Current Account", Expect: Separate},
+		{Name: "NoConfig", Config: missing, Institution: "monzo", Account: "Savings", Expect: Include},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			if m := tst.Config.Mode(tst.Institution, tst.Account); m != tst.Expect {
+				t.Fatalf("mismatch in pending mode\nhave: %s\nwant: %s", m, tst.Expect)
+			}
+		})
+	}
+
+	if c.Default != Exclude {
+		t.Fatalf("expected overriding default not to change the original config")
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	if _, err := LoadConfig("./", "test_invalid_pending.json"); err == nil {
+		t.Fatalf("expected error loading pending config with unknown mode")
+	}
+
+	c, _ := LoadConfig("./", "test_pending.json")
+	if _, err := c.WithDefault("sometimes"); err == nil {
+		t.Fatalf("expected error overriding default with unknown mode")
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/pendingmode"
+)
+
+// pendingSplitter includes, excludes or separates the pending transactions of each account, according to its
+// pending mode. pendingSplitter is not safe for concurrent use.
+type pendingSplitter struct {
+	settled exporter
+	// pending is only created once an account's pending transactions need writing separately
+	pending    exporter
+	newPending func() (exporter, error)
+	modes      pendingmode.Config
+	excluded   int
+}
+
+func newPendingSplitter(settled exporter, newPending func() (exporter, error), modes pendingmode.Config) *pendingSplitter {
+	return &pendingSplitter{
+		settled:    settled,
+		newPending: newPending,
+		modes:      modes,
+	}
+}
+
+func (s *pendingSplitter) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	mode := s.modes.Mode(institution, acct.Name)
+	if mode == pendingmode.Include {
+		return s.settled.writeTransactions(institution, acct, transactions)
+	}
+
+	var settled, pending []transaction
+	for _, tx := range transactions {
+		if tx.source.Pending {
+			pending = append(pending, tx)
+		} else {
+			settled = append(settled, tx)
+		}
+	}
+
+	if err := s.settled.writeTransactions(institution, acct, settled); err != nil {
+		return err
+	}
+
+	if mode == pendingmode.Exclude {
+		s.excluded += len(pending)
+		return nil
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if s.pending == nil {
+		var err error
+		if s.pending, err = s.newPending(); err != nil {
+			return err
+		}
+	}
+
+	return s.pending.writeTransactions(institution, acct, pending)
+}
+
+func (s *pendingSplitter) destination(institution string, acct plaid.AccountBase) string {
+	return s.settled.destination(institution, acct)
+}
+
+// Close reports the pending transactions excluded, and closes the exporters, returning the first error encountered
+func (s *pendingSplitter) Close() error {
+	if s.excluded != 0 {
+		fmt.Printf("Excluded %d pending transactions\n", s.excluded)
+	}
+
+	s.excluded = 0
+	err := s.settled.Close()
+	if s.pending != nil {
+		if pendingErr := s.pending.Close(); pendingErr != nil && err == nil {
+			err = pendingErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/gnucash"
+	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/pendingmode"
+)
+
+func testPendingTransactions(accountID string) []transaction {
+	return []transaction{
+		testPlaintextTransaction("Tesco", accountID, "2020-01-02", 10.26, "FOOD_AND_DRINK", "Groceries", false),
+		testPlaintextTransaction("Refund", accountID, "2020-01-03", -5, "GENERAL_MERCHANDISE", "Shopping", false),
+		testPlaintextTransaction("Cafe", accountID, "2020-01-30", 3.5, "FOOD_AND_DRINK", "Dining", true),
+	}
+}
+
+func TestPendingSplitter(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Modes pendingmode.Config
+		// Pending is nil if no exporter of pending transactions should be created
+		Settled, Pending map[string]int
+	}{
+		{
+			Name:    "IncludeByDefault",
+			Settled: map[string]int{"current": 3, "savings": 3},
+		},
+		{
+			Name:    "Include",
+			Modes:   pendingmode.Config{Default: pendingmode.Include},
+			Settled: map[string]int{"current": 3, "savings": 3},
+		},
+		{
+			Name:    "Exclude",
+			Modes:   pendingmode.Config{Default: pendingmode.Exclude},
+			Settled: map[string]int{"current": 2, "savings": 2},
+		},
+		{
+			Name:    "Separate",
+			Modes:   pendingmode.Config{Default: pendingmode.Separate},
+			Settled: map[string]int{"current": 2, "savings": 2},
+			Pending: map[string]int{"current": 1, "savings": 1},
+		},
+		{
+			Name: "AccountModes",
+			Modes: pendingmode.Config{Default: pendingmode.Exclude, Accounts: map[string]pendingmode.Mode{
+				"bank/savings": pendingmode.Separate,
+			}},
+			Settled: map[string]int{"current": 2, "savings": 2},
+			Pending: map[string]int{"savings": 1},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			settled := &fakeExporter{written: make(map[string]int)}
+			var pending *fakeExporter
+			s := newPendingSplitter(settled, func() (exporter, error) {
+				if pending != nil {
+					t.Fatal("expected exporter of pending transactions to be created once")
+				}
+
+				pending = &fakeExporter{written: make(map[string]int)}
+				return pending, nil
+			}, tst.Modes)
+
+			for _, name := range []string{"current", "savings"} {
+				acct := testPlaintextAccount(name, 100)
+				if err := s.writeTransactions("bank", acct, testPendingTransactions(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(settled.written, tst.Settled) {
+				t.Fatalf("mismatch in settled transactions\nhave: %v\nwant: %v", settled.written, tst.Settled)
+			}
+
+			switch {
+			case pending == nil && tst.Pending != nil:
+				t.Fatal("expected exporter of pending transactions to be created")
+			case pending != nil && !reflect.DeepEqual(pending.written, tst.Pending):
+				t.Fatalf("mismatch in pending transactions\nhave: %v\nwant: %v", pending.written, tst.Pending)
+			}
+		})
+	}
+}
+
+func TestNewExporter_PendingFiles(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Combine string
+		Expect  []string
+	}{
+		{Name: "Accounts", Combine: CombineNone, Expect: []string{"bank_current.pending.qif", "bank_current.qif"}},
+		{Name: "Institutions", Combine: CombineInstitution, Expect: []string{"bank.pending.qif", "bank.qif"}},
+		{Name: "All", Combine: CombineAll, Expect: []string{combinedName + ".pending.qif", combinedName + ".qif"}},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			p := testPlaidQIF(t)
+			dir := t.TempDir()
+
+			// exported transactions are recorded against their institution
+			conf := t.TempDir()
+			if err := os.WriteFile(filepath.Join(conf, "institutions.json"), []byte(`{"bank": {"Name": "bank"}}`), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var err error
+			if p.institutions, err = institutions.NewInstitutionManager(conf, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			until := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+			out, err := p.newExporter(OutputOptions{
+				OutDir:          dir,
+				Format:          FormatQIF,
+				Combine:         tst.Combine,
+				Pending:         string(pendingmode.Separate),
+				IncludeExported: true,
+			}, until.AddDate(0, -1, 0), until)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := out.writeTransactions("bank", testPlaintextAccount("current", 100), testPendingTransactions("current")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			sort.Strings(names)
+
+			if !reflect.DeepEqual(names, tst.Expect) {
+				t.Fatalf("mismatch in files written\nhave: %v\nwant: %v", names, tst.Expect)
+			}
+		})
+	}
+}
+
+// gnucash books can't hold pending transactions, and have no separate book to write them to, so they're always excluded
+func TestNewExporter_GnuCashExcludesPending(t *testing.T) {
+	schema, err := os.ReadFile(filepath.Join("gnucash", "testdata", "schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book := filepath.Join(t.TempDir(), "test.gnucash")
+	db, err := sql.Open("sqlite", book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	p := testPlaidQIF(t)
+	p.gnucash = gnucash.Config{Book: book}
+	p.pendingModes = pendingmode.Config{Accounts: map[string]pendingmode.Mode{"bank/current": pendingmode.Include}}
+
+	until := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	out, err := p.newExporter(OutputOptions{Format: FormatGnuCash, Pending: string(pendingmode.Separate)}, until.AddDate(0, -1, 0), until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	s, ok := out.(*pendingSplitter)
+	if !ok {
+		t.Fatalf("expected pending splitter, got: %T", out)
+	}
+
+	for _, name := range []string{"current", "savings"} {
+		if mode := s.modes.Mode("bank", name); mode != pendingmode.Exclude {
+			t.Fatalf("mismatch in pending mode of account '%s'\nhave: %s\nwant: %s", name, mode, pendingmode.Exclude)
+		}
+	}
+}
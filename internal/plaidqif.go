@@ -1,20 +1,46 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"strconv"
 
 	"github.com/plaid/plaid-go/plaid"
 
+	"github.com/chill/plaidqif/internal/accountpaths"
+	"github.com/chill/plaidqif/internal/cache"
+	"github.com/chill/plaidqif/internal/categories"
 	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/fx"
+	"github.com/chill/plaidqif/internal/gnucash"
 	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/learned"
+	"github.com/chill/plaidqif/internal/pendingmode"
+	"github.com/chill/plaidqif/internal/rules"
+	"github.com/chill/plaidqif/internal/splits"
+	"github.com/chill/plaidqif/internal/store"
+	"github.com/chill/plaidqif/internal/tabular"
 )
 
 type PlaidQIF struct {
 	institutions *institutions.InstitutionManager
+	categories   *categories.Mapper
+	splitter     *splits.Splitter
+	rules        *rules.Engine
+	learning     learned.Config
+	fx           *fx.Converter
+	accountPaths *accountpaths.Mapper
+	csvTemplate  tabular.Template
+	gnucash      gnucash.Config
+	pendingModes pendingmode.Config
+	store        *store.Store
+	cache        *cache.Cache
 	client       *plaid.PlaidApiService
+	plaidConfig  *plaid.Configuration
 	plaidCountry plaid.CountryCode
 	plaidEnv     string
 	clientName   string
@@ -59,9 +85,77 @@ func PlaidQif(confDir, plaidEnv, clientName, country, dateFormat string, listenP
 		return nil, err
 	}
 
+	categoryMapper, err := categories.NewMapper(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	splitter, err := splits.NewSplitter(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	rulesEngine, err := rules.NewEngine(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	learning, err := learned.LoadConfig(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	converter, err := fx.NewConverter(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	accountPaths, err := accountpaths.NewMapper(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	csvTemplate, err := tabular.LoadTemplate(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	gnucashConfig, err := gnucash.LoadConfig(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pendingModes, err := pendingmode.LoadConfig(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	responseCache, err := cache.New(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	transactionStore, err := store.Open(confDir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	client := newPlaidClient(creds, env)
 	return &PlaidQIF{
 		institutions: institutionMgr,
-		client:       newPlaidClient(creds, env).PlaidApi,
+		categories:   categoryMapper,
+		splitter:     splitter,
+		rules:        rulesEngine,
+		learning:     learning,
+		fx:           converter,
+		accountPaths: accountPaths,
+		csvTemplate:  csvTemplate,
+		gnucash:      gnucashConfig,
+		pendingModes: pendingModes,
+		store:        transactionStore,
+		cache:        responseCache,
+		client:       client.PlaidApi,
+		plaidConfig:  client.GetConfig(),
 		plaidCountry: *countryCode,
 		plaidEnv:     plaidEnv,
 		clientName:   clientName,
@@ -71,11 +165,21 @@ func PlaidQif(confDir, plaidEnv, clientName, country, dateFormat string, listenP
 	}, nil
 }
 
-// Close writes any updates to institutions that took place during the execution of a command, to disk
+// Close writes any updates to institutions that took place during the execution of a command, to disk,
+// and closes the transaction store
 func (p *PlaidQIF) Close() error {
-	return p.institutions.WriteInstitutions()
+	if err := p.institutions.WriteInstitutions(); err != nil {
+		p.store.Close()
+		return err
+	}
+
+	return p.store.Close()
 }
 
+// optionalProducts are added to new links where the institution offers them, for the liabilities command and
+// investment downloads, without failing to link institutions that only offer transactions
+var optionalProducts = []plaid.Products{plaid.PRODUCTS_INVESTMENTS, plaid.PRODUCTS_LIABILITIES}
+
 // getLinkToken returns a link token for use in the link "setup" flow.
 func (p *PlaidQIF) getLinkToken() (string, error) {
 	products := []plaid.Products{plaid.PRODUCTS_TRANSACTIONS}
@@ -88,7 +192,7 @@ func (p *PlaidQIF) getLinkToken() (string, error) {
 		CountryCodes: []plaid.CountryCode{p.plaidCountry},
 		Language:     "en",
 		Products:     &products,
-	})
+	}, optionalProducts)
 }
 
 // getLinkUpdateToken returns a link token for use in the link "update" flow.
@@ -101,16 +205,64 @@ func (p *PlaidQIF) getLinkUpdateToken(ins institutions.Institution) (string, err
 		CountryCodes: []plaid.CountryCode{p.plaidCountry},
 		Language:     "en",
 		AccessToken:  &ins.AccessToken,
-	})
+	}, nil)
 }
 
-func (p *PlaidQIF) createLinkToken(req plaid.LinkTokenCreateRequest) (string, error) {
-	r := p.client.LinkTokenCreate(context.TODO())
-	r = r.LinkTokenCreateRequest(req)
-	resp, _, err := r.Execute()
+// createLinkToken posts req to plaid itself, as plaid-go's LinkTokenCreateRequest has no optional_products
+func (p *PlaidQIF) createLinkToken(req plaid.LinkTokenCreateRequest, optional []plaid.Products) (string, error) {
+	body, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("unable to create link token, request ID: '%s', err: %w",
-			resp.RequestId, err)
+		return "", fmt.Errorf("failed to marshal link token request: %w", err)
+	}
+
+	if len(optional) != 0 {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return "", fmt.Errorf("failed to add optional products to link token request: %w", err)
+		}
+
+		fields["optional_products"] = optional
+		if body, err = json.Marshal(fields); err != nil {
+			return "", fmt.Errorf("failed to marshal link token request: %w", err)
+		}
+	}
+
+	cfg := p.plaidConfig
+	url, err := cfg.ServerURLWithContext(context.TODO(), "PlaidApiService.LinkTokenCreate")
+	if err != nil {
+		return "", fmt.Errorf("unable to create link token: %w", err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url+"/link/token/create", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("unable to create link token: %w", err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", cfg.UserAgent)
+	for header, value := range cfg.DefaultHeader {
+		r.Header.Set(header, value)
+	}
+
+	httpResp, err := cfg.HTTPClient.Do(r)
+	if err != nil {
+		return "", fmt.Errorf("unable to create link token: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		var plaidErr plaid.Error
+		if err := json.NewDecoder(httpResp.Body).Decode(&plaidErr); err != nil {
+			return "", fmt.Errorf("unable to create link token, status: %s", httpResp.Status)
+		}
+
+		return "", fmt.Errorf("unable to create link token, request ID: '%s', err: %s: %s",
+			plaidErr.GetRequestId(), plaidErr.ErrorCode, plaidErr.ErrorMessage)
+	}
+
+	var resp plaid.LinkTokenCreateResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return "", fmt.Errorf("failed to unmarshal link token response: %w", err)
 	}
 
 	return resp.LinkToken, nil
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+)
+
+func TestCreateLinkToken(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Update    bool
+		Status    int
+		ExpectErr bool
+		// Optional is nil if the request shouldn't have optional_products
+		Optional []interface{}
+	}{
+		{Name: "Setup", Status: http.StatusOK, Optional: []interface{}{"investments", "liabilities"}},
+		{Name: "Update", Update: true, Status: http.StatusOK},
+		{Name: "PlaidError", Status: http.StatusBadRequest, ExpectErr: true, Optional: []interface{}{"investments", "liabilities"}},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			var fields map[string]interface{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/link/token/create" || r.Header.Get("PLAID-CLIENT-ID") != "client" {
+					t.Errorf("unexpected request to '%s'", r.URL.Path)
+				}
+
+				if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+					t.Error(err)
+				}
+
+				w.WriteHeader(tst.Status)
+				if tst.Status != http.StatusOK {
+					json.NewEncoder(w).Encode(plaid.Error{ErrorCode: "INVALID_FIELD", ErrorMessage: "bad request"})
+					return
+				}
+
+				json.NewEncoder(w).Encode(plaid.LinkTokenCreateResponse{LinkToken: "link-token"})
+			}))
+			defer srv.Close()
+
+			p := testPlaidQIF(t)
+			p.plaidConfig.UseEnvironment(plaid.Environment(srv.URL))
+
+			var token string
+			var err error
+			if tst.Update {
+				token, err = p.getLinkUpdateToken(institutions.Institution{AccessToken: "access-token"})
+			} else {
+				token, err = p.getLinkToken()
+			}
+
+			if tst.ExpectErr {
+				if err == nil {
+					t.Fatal("expected error creating link token")
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if token != "link-token" {
+					t.Fatalf("mismatch in link token\nhave: %s\nwant: link-token", token)
+				}
+			}
+
+			optional, ok := fields["optional_products"].([]interface{})
+			if !ok && tst.Optional != nil || ok && !reflect.DeepEqual(optional, tst.Optional) {
+				t.Fatalf("mismatch in optional products\nhave: %v\nwant: %v", fields["optional_products"], tst.Optional)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package plaintext
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Beancount spec: https://beancount.github.io/docs/beancount_language_syntax.html
+// Ledger spec: https://ledger-cli.org/doc/ledger3.html#Journal-Format, which hledger also reads
+
+// Dialect is the plain text accounting language to write
+type Dialect string
+
+const (
+	Beancount Dialect = "beancount"
+	Ledger    Dialect = "ledger"
+)
+
+// Transaction is a balanced transaction: the amounts of its postings must sum to zero in each currency
+type Transaction struct {
+	Date      time.Time
+	Payee     string
+	Narration string
+	// Code is the check or reference number
+	Code    string
+	Pending bool
+	// Metadata is written in key order, keys must be lowercase to be valid beancount
+	Metadata map[string]string
+	Postings []Posting
+}
+
+// Posting moves Amount into Account, so amounts leaving an account are negative
+type Posting struct {
+	Account string
+	Amount  money.Amount
+	// Price, if set, is the unsigned total cost of Amount in another currency, which the posting balances in
+	Price   *money.Amount
+	Comment string
+}
+
+// Balance asserts the balance of Account at the end of Date
+type Balance struct {
+	Date    time.Time
+	Account string
+	Amount  money.Amount
+}
+
+// Open opens Account on Date, which must be on or before the first transaction or balance assertion using it.
+// Ledger has no dates for accounts, so only declares it.
+type Open struct {
+	Date    time.Time
+	Account string
+}
+
+type meta struct {
+	Key   string
+	Value string
+}
+
+type posting struct {
+	Account string
+	Amount  string
+	Comment string
+}
+
+type transaction struct {
+	Date      string
+	Flag      string
+	Payee     string
+	Narration string
+	Code      string
+	Metadata  []meta
+	Postings  []posting
+}
+
+type open struct {
+	Date    string
+	Account string
+}
+
+type balance struct {
+	Date    string
+	Account string
+	Amount  string
+	Zero    string
+}
+
+// the formats intentionally start with a newline, to separate entries with a blank line
+
+const beancountTxFmt = `
+{{.Date}} {{.Flag}} {{.Payee}} {{.Narration}}
+{{- range .Metadata}}
+  {{.Key}}: {{.Value}}
+{{- end}}
+{{- range .Postings}}
+  {{.Account}}  {{.Amount}}{{if .Comment}} ; {{.Comment}}{{end}}
+{{- end}}
+`
+
+// accounts are opened one per line, before the entries using them
+
+const beancountOpenFmt = `{{.Date}} open {{.Account}}
+`
+
+const beancountBalanceFmt = `
+{{.Date}} balance {{.Account}}  {{.Amount}}
+`
+
+const ledgerTxFmt = `
+{{.Date}} {{.Flag}}{{if .Code}} ({{.Code}}){{end}} {{.Payee}}
+{{- if .Narration}}
+    ; {{.Narration}}
+{{- end}}
+{{- range .Metadata}}
+    ; {{.Key}}: {{.Value}}
+{{- end}}
+{{- range .Postings}}
+    {{.Account}}  {{.Amount}}{{if .Comment}}  ; {{.Comment}}{{end}}
+{{- end}}
+`
+
+const ledgerOpenFmt = `account {{.Account}}
+`
+
+const ledgerBalanceFmt = `
+{{.Date}} * Balance assertion
+    {{.Account}}  {{.Zero}} = {{.Amount}}
+`
+
+var (
+	beancountTxTemplate      = template.Must(template.New("beancountTxFmt").Parse(beancountTxFmt))
+	beancountOpenTemplate    = template.Must(template.New("beancountOpenFmt").Parse(beancountOpenFmt))
+	beancountBalanceTemplate = template.Must(template.New("beancountBalanceFmt").Parse(beancountBalanceFmt))
+	ledgerTxTemplate         = template.Must(template.New("ledgerTxFmt").Parse(ledgerTxFmt))
+	ledgerOpenTemplate       = template.Must(template.New("ledgerOpenFmt").Parse(ledgerOpenFmt))
+	ledgerBalanceTemplate    = template.Must(template.New("ledgerBalanceFmt").Parse(ledgerBalanceFmt))
+)
+
+// Writer is not safe for concurrent use
+type Writer struct {
+	w       io.Writer
+	dialect Dialect
+	err     error
+}
+
+// NewWriter returns a Writer which is not safe for concurrent use
+func NewWriter(w io.Writer, dialect Dialect) *Writer {
+	return &Writer{
+		w:       w,
+		dialect: dialect,
+	}
+}
+
+// WriteOpens opens accounts, which should come before the entries using them
+func (w *Writer) WriteOpens(opens []Open) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	for _, o := range opens {
+		tmpl, op := ledgerOpenTemplate, open{Account: o.Account}
+		if w.dialect == Beancount {
+			tmpl, op.Date = beancountOpenTemplate, o.Date.Format("2006-01-02")
+		}
+
+		if err := w.execute(tmpl, op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) WriteTransactions(transactions []Transaction) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	for _, tx := range transactions {
+		if err := w.WriteTransaction(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) WriteTransaction(tx Transaction) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := checkBalanced(tx); err != nil {
+		return err
+	}
+
+	transaction := transaction{
+		Flag: "*",
+		Code: tx.Code,
+	}
+
+	if tx.Pending {
+		transaction.Flag = "!"
+	}
+
+	keys := make([]string, 0, len(tx.Metadata))
+	for k := range tx.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tmpl := ledgerTxTemplate
+	if w.dialect == Beancount {
+		tmpl = beancountTxTemplate
+		transaction.Date = tx.Date.Format("2006-01-02")
+		transaction.Payee = quote(tx.Payee)
+		transaction.Narration = quote(tx.Narration)
+
+		// beancount has no transaction codes, so keep them as metadata instead
+		if tx.Code != "" {
+			transaction.Metadata = append(transaction.Metadata, meta{Key: "code", Value: quote(tx.Code)})
+		}
+
+		for _, k := range keys {
+			transaction.Metadata = append(transaction.Metadata, meta{Key: k, Value: quote(tx.Metadata[k])})
+		}
+	} else {
+		transaction.Date = tx.Date.Format("2006/01/02")
+		transaction.Payee = oneLine(tx.Payee)
+		transaction.Narration = oneLine(tx.Narration)
+
+		for _, k := range keys {
+			transaction.Metadata = append(transaction.Metadata, meta{Key: k, Value: oneLine(tx.Metadata[k])})
+		}
+	}
+
+	for _, p := range tx.Postings {
+		amount := formatAmount(p.Amount)
+		if p.Price != nil {
+			amount += " @@ " + formatAmount(*p.Price)
+		}
+
+		transaction.Postings = append(transaction.Postings, posting{
+			Account: p.Account,
+			Amount:  amount,
+			Comment: oneLine(p.Comment),
+		})
+	}
+
+	return w.execute(tmpl, transaction)
+}
+
+// WriteBalances writes balance assertions, which should come after the transactions they cover
+func (w *Writer) WriteBalances(balances []Balance) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	for _, b := range balances {
+		if err := w.writeBalance(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) writeBalance(b Balance) error {
+	bal := balance{
+		Account: b.Account,
+		Amount:  formatAmount(b.Amount),
+		Zero:    formatAmount(money.New(0, b.Amount.Currency)),
+	}
+
+	tmpl := ledgerBalanceTemplate
+	if w.dialect == Beancount {
+		// beancount checks balances at the start of the day
+		tmpl = beancountBalanceTemplate
+		bal.Date = b.Date.AddDate(0, 0, 1).Format("2006-01-02")
+	} else {
+		bal.Date = b.Date.Format("2006/01/02")
+	}
+
+	return w.execute(tmpl, bal)
+}
+
+func (w *Writer) execute(tmpl *template.Template, data interface{}) error {
+	if err := tmpl.Execute(w.w, data); err != nil {
+		w.err = err
+		return err
+	}
+
+	return nil
+}
+
+// checkBalanced errors if the postings of tx don't sum to zero in every currency,
+// counting priced postings in the currency of their price
+func checkBalanced(tx Transaction) error {
+	sums := make(map[string]money.Amount)
+	for _, p := range tx.Postings {
+		weight := p.Amount
+		if p.Price != nil {
+			weight = *p.Price
+			if p.Amount.Sign() != weight.Sign() {
+				weight = weight.Neg()
+			}
+		}
+
+		sum, ok := sums[weight.Currency]
+		if !ok {
+			sum = money.New(0, weight.Currency)
+		}
+
+		var err error
+		if sums[weight.Currency], err = sum.Add(weight); err != nil {
+			return err
+		}
+	}
+
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("transaction '%s' on %s does not balance, postings in %s sum to %s",
+				tx.Payee, tx.Date.Format("2006-01-02"), currency, sum)
+		}
+	}
+
+	return nil
+}
+
+func formatAmount(a money.Amount) string {
+	if a.Currency == "" {
+		return a.String()
+	}
+
+	return fmt.Sprintf("%s %s", a, strings.ToUpper(a.Currency))
+}
+
+var quoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ")
+
+// quote returns s as a beancount string
+func quote(s string) string {
+	return `"` + quoter.Replace(s) + `"`
+}
+
+// oneLine stops s breaking out of the line it's written on
+func oneLine(s string) string {
+	return strings.ReplaceAll(s, "\n", " ")
+}
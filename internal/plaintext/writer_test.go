@@ -0,0 +1,134 @@
+package plaintext
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func testTransactions() []Transaction {
+	price := money.MustParse("8.60", "GBP")
+	return []Transaction{
+		{
+			Date:      time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			Payee:     `The "Best" Shop`,
+			Narration: "Pending",
+			Code:      "1042",
+			Pending:   true,
+			Metadata:  map[string]string{"plaid_transaction_id": "tx-1", "account": "acct-1"},
+			Postings: []Posting{
+				{Account: "Assets:Bank:Current", Amount: money.MustParse("-10.26", "GBP")},
+				{Account: "Expenses:Groceries", Amount: money.MustParse("10.26", "GBP")},
+			},
+		},
+		{
+			Date:     time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+			Payee:    "Tesco",
+			Metadata: map[string]string{"plaid_transaction_id": "tx-2"},
+			Postings: []Posting{
+				{Account: "Assets:Bank:Current", Amount: money.MustParse("-20", "GBP")},
+				{Account: "Expenses:Household", Amount: money.MustParse("5", "GBP"), Comment: "cleaning"},
+				{Account: "Expenses:Groceries", Amount: money.MustParse("15", "GBP")},
+			},
+		},
+		{
+			Date:     time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+			Payee:    "Carrefour",
+			Metadata: map[string]string{"plaid_transaction_id": "tx-3"},
+			Postings: []Posting{
+				{Account: "Assets:Bank:Euro", Amount: money.MustParse("-10", "EUR"), Price: &price},
+				{Account: "Expenses:Groceries", Amount: money.MustParse("8.60", "GBP")},
+			},
+		},
+	}
+}
+
+func testOpens() []Open {
+	return []Open{
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), Account: "Assets:Bank:Current"},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), Account: "Expenses:Groceries"},
+		{Date: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), Account: "Expenses:Household"},
+		{Date: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC), Account: "Assets:Bank:Euro"},
+	}
+}
+
+func testBalances() []Balance {
+	return []Balance{
+		{Date: time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), Account: "Assets:Bank:Current", Amount: money.MustParse("1234.56", "GBP")},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Dialect Dialect
+	}{
+		{Name: "transactions.beancount", Dialect: Beancount},
+		{Name: "transactions.journal", Dialect: Ledger},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewWriter(&out, tst.Dialect)
+
+			if err := w.WriteOpens(testOpens()); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteTransactions(testTransactions()); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteBalances(testBalances()); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tst.Name)
+			if *updateGolden {
+				if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.String(); got != string(expect) {
+				t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+			}
+		})
+	}
+}
+
+func TestWriteTransactionUnbalanced(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, Ledger)
+
+	err := w.WriteTransaction(Transaction{
+		Date:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Payee: "Tesco",
+		Postings: []Posting{
+			{Account: "Assets:Bank:Current", Amount: money.MustParse("-10.26", "GBP")},
+			{Account: "Expenses:Groceries", Amount: money.MustParse("10", "GBP")},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not balance") {
+		t.Fatalf("expected unbalanced transaction error, got: %v", err)
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got:\n%s", out.String())
+	}
+}
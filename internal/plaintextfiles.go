@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/accountpaths"
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/plaintext"
+)
+
+type plaintextFile struct {
+	path string
+	f    *os.File
+	// w writes to body, which is only written to f on Close, after the accounts it uses are opened
+	w        *plaintext.Writer
+	body     bytes.Buffer
+	balances []plaintext.Balance
+	// opened is the date each account is first used in the file
+	opened map[string]time.Time
+	// pending holds the accounts with pending postings, which plaid's current balances don't include
+	pending map[string]bool
+}
+
+// plaintextFiles writes transactions as plain text accounting journals, opening files for accounts as they are
+// needed, opening each account used at the start of its file, and asserting the balance of each account at the end
+// of its file. plaintextFiles is not safe for concurrent use.
+type plaintextFiles struct {
+	opts    OutputOptions
+	dialect plaintext.Dialect
+	paths   *accountpaths.Mapper
+	until   time.Time
+	// assertBalances is false when plaid's current balances aren't the balances at the end of the download
+	assertBalances bool
+	files          map[string]*plaintextFile
+	seen           map[string]bool
+	order          []string
+}
+
+func newPlaintextFiles(opts OutputOptions, dialect plaintext.Dialect, paths *accountpaths.Mapper, until time.Time) (*plaintextFiles, error) {
+	opts, err := validateOutputOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	assertBalances := balancesAreCurrent(until)
+	if !assertBalances {
+		fmt.Printf("Not asserting balances, as the download ends before today\n")
+	}
+
+	return &plaintextFiles{
+		opts:           opts,
+		dialect:        dialect,
+		paths:          paths,
+		until:          until,
+		assertBalances: assertBalances,
+		files:          make(map[string]*plaintextFile),
+		seen:           make(map[string]bool),
+	}, nil
+}
+
+func (t *plaintextFiles) destination(institution string, acct plaid.AccountBase) string {
+	path, _ := outputPath(t.opts, institution, acct, string(t.dialect))
+	return path
+}
+
+func (t *plaintextFiles) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	pf, err := t.file(institution, acct)
+	if err != nil {
+		return err
+	}
+
+	accountPath := t.paths.Account(institution, acct.Name, isLiabilityAccount(acct))
+	if !t.seen[acct.AccountId] {
+		t.seen[acct.AccountId] = true
+		if err := t.addBalance(pf, accountPath, acct); err != nil {
+			return err
+		}
+	}
+
+	txs := make([]plaintext.Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		// the account's balance is asserted even if all its transactions are transfers written from other accounts
+		pf.use(accountPath, tx.Date)
+
+		// a transfer posts to both accounts, so is only written from the account money leaves, which plaid
+		// gives a positive amount, and written to that account's file. Transfers are unmatched when a side was
+		// written by an earlier run, so that side is always written in this one.
+		if tx.transfer != nil && tx.Amount.Sign() < 0 {
+			continue
+		}
+
+		ptx := plaintext.Transaction{
+			Date:      tx.Date,
+			Payee:     tx.Payee,
+			Narration: tx.Memo,
+			Code:      tx.Number,
+			Pending:   tx.source.Pending,
+			Metadata:  map[string]string{"plaid_transaction_id": tx.source.TransactionId},
+			// plaid amounts are positive when money leaves the account
+			Postings: []plaintext.Posting{{Account: accountPath, Amount: tx.original.Neg()}},
+		}
+
+		// accounts are posted to in their own currency, so their balances can be asserted,
+		// priced in the reporting currency the other postings were converted to
+		if tx.original.Currency != tx.Amount.Currency {
+			price := tx.Amount
+			if price.Sign() < 0 {
+				price = price.Neg()
+			}
+
+			ptx.Postings[0].Price = &price
+		}
+
+		switch {
+		case tx.transfer != nil:
+			// transfers are only matched between amounts in the same currency
+			other := t.paths.Account(tx.transfer.institution, tx.transfer.acct.Name, isLiabilityAccount(tx.transfer.acct))
+			ptx.Postings[0].Price = nil
+			ptx.Postings = append(ptx.Postings, plaintext.Posting{Account: other, Amount: tx.original})
+		case len(tx.Splits) == 0:
+			ptx.Postings = append(ptx.Postings, plaintext.Posting{Account: t.paths.Category(tx.Category, isIncome(tx)), Amount: tx.Amount})
+		}
+
+		for _, s := range tx.Splits {
+			ptx.Postings = append(ptx.Postings, plaintext.Posting{Account: t.paths.Category(s.Category, isIncome(tx)), Amount: s.Amount, Comment: s.Memo})
+		}
+
+		for _, p := range ptx.Postings {
+			pf.use(p.Account, tx.Date)
+			if ptx.Pending {
+				pf.pending[p.Account] = true
+			}
+		}
+
+		txs = append(txs, ptx)
+	}
+
+	if err := pf.w.WriteTransactions(txs); err != nil {
+		return fmt.Errorf("failed to write transactions to %s writer: %w", t.dialect, err)
+	}
+
+	return nil
+}
+
+func (t *plaintextFiles) file(institution string, acct plaid.AccountBase) (*plaintextFile, error) {
+	path, _ := outputPath(t.opts, institution, acct, string(t.dialect))
+	if pf, ok := t.files[path]; ok {
+		return pf, nil
+	}
+
+	f, err := files.OpenWriter(path, string(t.dialect))
+	if err != nil {
+		return nil, err
+	}
+
+	pf := &plaintextFile{path: path, f: f, opened: make(map[string]time.Time), pending: make(map[string]bool)}
+	pf.w = plaintext.NewWriter(&pf.body, t.dialect)
+	t.files[path] = pf
+	t.order = append(t.order, path)
+	return pf, nil
+}
+
+// assertedBalances returns the balances to assert, leaving out accounts with pending postings, as beancount and
+// ledger count pending postings in balances, but plaid's current balances don't
+func (pf *plaintextFile) assertedBalances() []plaintext.Balance {
+	balances := make([]plaintext.Balance, 0, len(pf.balances))
+	for _, b := range pf.balances {
+		if pf.pending[b.Account] {
+			fmt.Printf("Not asserting the balance of '%s' in '%s', as it has pending transactions\n", b.Account, pf.path)
+			continue
+		}
+
+		balances = append(balances, b)
+	}
+
+	return balances
+}
+
+// use notes that an account is used on a date, so it is opened by then
+func (pf *plaintextFile) use(account string, date time.Time) {
+	if opened, ok := pf.opened[account]; !ok || date.Before(opened) {
+		pf.opened[account] = date
+	}
+}
+
+// opens returns the accounts used in the file, opened on the date they were first used
+func (pf *plaintextFile) opens() []plaintext.Open {
+	opens := make([]plaintext.Open, 0, len(pf.opened))
+	for account, date := range pf.opened {
+		opens = append(opens, plaintext.Open{Date: date, Account: account})
+	}
+
+	sort.Slice(opens, func(i, j int) bool {
+		if !opens[i].Date.Equal(opens[j].Date) {
+			return opens[i].Date.Before(opens[j].Date)
+		}
+
+		return opens[i].Account < opens[j].Account
+	})
+
+	return opens
+}
+
+// isIncome returns true if plaid categorises a transaction as income. Other money coming in, such as refunds,
+// is posted against the expense it reverses.
+func isIncome(tx transaction) bool {
+	pfc := tx.source.PersonalFinanceCategory.Get()
+	return pfc != nil && pfc.Primary == "INCOME"
+}
+
+// addBalance adds an assertion of the account's current balance at the end of the download to its file
+func (t *plaintextFiles) addBalance(pf *plaintextFile, accountPath string, acct plaid.AccountBase) error {
+	current := acct.Balances.Current.Get()
+	if !t.assertBalances || current == nil {
+		return nil
+	}
+
+	currency := currencyCode(acct.Balances.IsoCurrencyCode, acct.Balances.UnofficialCurrencyCode)
+	amount, err := money.FromFloat32(*current, currency)
+	if err != nil {
+		return fmt.Errorf("failed to convert current balance of account '%s': %w", acct.Name, err)
+	}
+
+	// plaid balances of credit and loan accounts are positive when money is owed
+	if isLiabilityAccount(acct) {
+		amount = amount.Neg()
+	}
+
+	pf.balances = append(pf.balances, plaintext.Balance{Date: t.until, Account: accountPath, Amount: amount})
+	return nil
+}
+
+// Close writes each file, opening the accounts it uses before its transactions, and asserting balances after them,
+// and closes them, returning the first error encountered
+func (t *plaintextFiles) Close() error {
+	var firstErr error
+	for _, path := range t.order {
+		pf := t.files[path]
+		if err := pf.w.WriteBalances(pf.assertedBalances()); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write balances to %s file '%s': %w", t.dialect, pf.path, err)
+		}
+
+		if err := plaintext.NewWriter(pf.f, t.dialect).WriteOpens(pf.opens()); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write accounts to %s file '%s': %w", t.dialect, pf.path, err)
+		}
+
+		if _, err := pf.body.WriteTo(pf.f); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write %s file '%s': %w", t.dialect, pf.path, err)
+		}
+
+		if err := pf.f.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close %s file '%s': %w", t.dialect, pf.path, err)
+		}
+	}
+
+	t.files = make(map[string]*plaintextFile)
+	t.seen = make(map[string]bool)
+	t.order = nil
+	return firstErr
+}
+
+// balancesAreCurrent returns true if a download until the date ends today or later, as plaid only knows
+// the current balance of each account, which is only its balance at the end of the download if nothing happened since
+func balancesAreCurrent(until time.Time) bool {
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, until.Location())
+	return !until.Before(today)
+}
+
+func isLiabilityAccount(acct plaid.AccountBase) bool {
+	return acct.Type == plaid.ACCOUNTTYPE_CREDIT || acct.Type == plaid.ACCOUNTTYPE_LOAN
+}
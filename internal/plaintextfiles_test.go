@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/accountpaths"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/plaintext"
+	"github.com/chill/plaidqif/internal/qif"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func testPlaintextAccount(id string, current float32) plaid.AccountBase {
+	acct := testLiabilityAccount(id, &current)
+	acct.Type = plaid.ACCOUNTTYPE_DEPOSITORY
+	return acct
+}
+
+func testPlaintextTransaction(id, accountID, date string, amount float32, primary, category string, pending bool) transaction {
+	src := testTransfer(id, accountID, date, amount, primary)
+	src.Pending = pending
+
+	d, err := time.Parse(plaidDateFormat, date)
+	if err != nil {
+		panic(err)
+	}
+
+	a, err := money.FromFloat32(amount, "GBP")
+	if err != nil {
+		panic(err)
+	}
+
+	return transaction{
+		Transaction: qif.Transaction{Date: d, Payee: id, Amount: a, Category: category},
+		source:      src,
+		original:    a,
+	}
+}
+
+func TestPlaintextFiles_PendingBalances(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Dialect plaintext.Dialect
+	}{
+		{Name: "pending.beancount", Dialect: plaintext.Beancount},
+		{Name: "pending.journal", Dialect: plaintext.Ledger},
+	}
+
+	paths, err := accountpaths.NewMapper(".", "does_not_exist.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			dir := t.TempDir()
+			out, err := newPlaintextFiles(OutputOptions{OutDir: dir, Combine: CombineAll}, tst.Dialect, paths, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// balances are only asserted when the download ends today, so pin it for the golden file
+			out.until, out.assertBalances = time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), true
+
+			// the current account's balance isn't asserted, as it has a pending transaction
+			current := testPlaintextAccount("current", 1000)
+			if err := out.writeTransactions("bank", current, []transaction{
+				testPlaintextTransaction("Tesco", "current", "2020-01-02", 10.26, "FOOD_AND_DRINK", "Groceries", false),
+				testPlaintextTransaction("Refund", "current", "2020-01-03", -5, "GENERAL_MERCHANDISE", "Shopping", false),
+				testPlaintextTransaction("Cafe", "current", "2020-01-30", 3.5, "FOOD_AND_DRINK", "Dining", true),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			savings := testPlaintextAccount("savings", 500)
+			if err := out.writeTransactions("bank", savings, []transaction{
+				testPlaintextTransaction("Interest", "savings", "2020-01-31", -1.23, "INCOME", "Interest", false),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(dir, combinedName+"."+string(tst.Dialect)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tst.Name)
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != string(expect) {
+				t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+			}
+		})
+	}
+}
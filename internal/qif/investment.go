@@ -0,0 +1,248 @@
+package qif
+
+import (
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// InvestmentAccountType is the QIF type of investment accounts, whose transactions must be InvestmentTransactions
+const InvestmentAccountType = "Invst"
+
+// Investment actions, written as the N field of investment transactions
+const (
+	ActionBuy           = "Buy"
+	ActionSell          = "Sell"
+	ActionDividend      = "Div"
+	ActionReinvDividend = "ReinvDiv"
+	ActionInterest      = "IntInc"
+	ActionReinvInterest = "ReinvInt"
+	ActionCGLong        = "CGLong"
+	ActionCGShort       = "CGShort"
+	ActionReinvCGLong   = "ReinvLg"
+	ActionReinvCGShort  = "ReinvSh"
+	ActionReturnCapital = "RtrnCap"
+	ActionSharesIn      = "ShrsIn"
+	ActionSharesOut     = "ShrsOut"
+	ActionMiscExpense   = "MiscExp"
+	ActionMiscIncome    = "MiscInc"
+	ActionCashIn        = "XIn"
+	ActionCashOut       = "XOut"
+)
+
+// InvestmentTransaction is a transaction in an investment account.
+// Amount and Commission are written unsigned, the direction of money is given by Action.
+type InvestmentTransaction struct {
+	Date       time.Time
+	Action     string
+	Security   string
+	Price      float64
+	Quantity   float64
+	Amount     money.Amount
+	Commission money.Amount
+	Payee      string
+	Memo       string
+	Cleared    ClearedStatus
+}
+
+// Security is an entry in the QIF security list
+type Security struct {
+	Name   string
+	Symbol string
+	// Type is the QIF security type, such as Stock, Mutual Fund or Bond
+	Type string
+}
+
+// Price is the price of a security, identified by Symbol, on a date
+type Price struct {
+	Symbol string
+	Price  float64
+	Date   time.Time
+}
+
+type investmentTransaction struct {
+	Date       string
+	Action     string
+	Security   string
+	Price      string
+	Quantity   string
+	Amount     string
+	Commission string
+	Payee      string
+	Memo       string
+	Cleared    string
+}
+
+type price struct {
+	Symbol string
+	Price  string
+	Date   string
+}
+
+// invstTxFmt intentionally starts with a newline
+const invstTxFmt = `
+D{{.Date}}
+N{{.Action}}
+{{- if .Security}}
+Y{{.Security}}
+{{- end}}
+{{- if .Price}}
+I{{.Price}}
+{{- end}}
+{{- if .Quantity}}
+Q{{.Quantity}}
+{{- end}}
+T{{.Amount}}
+{{- if .Commission}}
+O{{.Commission}}
+{{- end}}
+{{- if .Cleared}}
+C{{.Cleared}}
+{{- end}}
+{{- if .Payee}}
+P{{.Payee}}
+{{- end}}
+{{- if .Memo}}
+M{{.Memo}}
+{{- end}}
+^`
+
+const securitiesFmt = `!Type:Security
+{{- range .}}
+N{{.Name}}
+{{- if .Symbol}}
+S{{.Symbol}}
+{{- end}}
+{{- if .Type}}
+T{{.Type}}
+{{- end}}
+^
+{{- end}}`
+
+const pricesFmt = `!Type:Prices
+{{- range .}}
+"{{.Symbol}}",{{.Price}},"{{.Date}}"
+^
+{{- end}}`
+
+var (
+	invstTxTemplate    = template.Must(template.New("invstTxFmt").Parse(invstTxFmt))
+	securitiesTemplate = template.Must(template.New("securitiesFmt").Parse(securitiesFmt))
+	pricesTemplate     = template.Must(template.New("pricesFmt").Parse(pricesFmt))
+)
+
+func (w *Writer) WriteInvestmentTransactions(transactions []InvestmentTransaction) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	for _, tx := range transactions {
+		if err := w.WriteInvestmentTransaction(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) WriteInvestmentTransaction(tx InvestmentTransaction) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	return w.writeInvestmentTransaction(tx)
+}
+
+func (w *Writer) writeInvestmentTransaction(tx InvestmentTransaction) error {
+	transaction := investmentTransaction{
+		Date:     tx.Date.Format(w.dateFormat),
+		Action:   tx.Action,
+		Security: tx.Security,
+		Price:    formatDecimal(tx.Price),
+		Quantity: formatDecimal(tx.Quantity),
+		Amount:   unsigned(tx.Amount).String(),
+		Payee:    tx.Payee,
+		Memo:     tx.Memo,
+		Cleared:  string(tx.Cleared),
+	}
+
+	if !tx.Commission.IsZero() {
+		transaction.Commission = unsigned(tx.Commission).String()
+	}
+
+	if err := invstTxTemplate.Execute(w.w, transaction); err != nil {
+		w.err = err
+		return err
+	}
+
+	return nil
+}
+
+// WriteSecurities writes a security list. Any transactions written afterwards start a new account header.
+func (w *Writer) WriteSecurities(securities []Security) error {
+	if w.err != nil || len(securities) == 0 {
+		return w.err
+	}
+
+	return w.writeList(securitiesTemplate, securities)
+}
+
+// WritePrices writes a price list. Any transactions written afterwards start a new account header.
+func (w *Writer) WritePrices(prices []Price) error {
+	if w.err != nil || len(prices) == 0 {
+		return w.err
+	}
+
+	ps := make([]price, 0, len(prices))
+	for _, p := range prices {
+		ps = append(ps, price{
+			Symbol: p.Symbol,
+			Price:  strconv.FormatFloat(p.Price, 'f', -1, 64),
+			Date:   p.Date.Format(w.dateFormat),
+		})
+	}
+
+	return w.writeList(pricesTemplate, ps)
+}
+
+func (w *Writer) writeList(tmpl *template.Template, data interface{}) error {
+	if err := w.writePrefix(); err != nil {
+		return err
+	}
+
+	// the list ends the current account's section, so its header must be written again
+	w.wroteHeader = false
+	if err := tmpl.Execute(w.w, data); err != nil {
+		w.err = err
+		return err
+	}
+
+	return nil
+}
+
+// formatDecimal formats prices and quantities, unsigned, with as many decimal places as they need
+func formatDecimal(f float64) string {
+	if f == 0 {
+		return ""
+	}
+
+	if f < 0 {
+		f = -f
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func unsigned(a money.Amount) money.Amount {
+	if a.Sign() < 0 {
+		return a.Neg()
+	}
+
+	return a
+}
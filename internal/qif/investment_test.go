@@ -0,0 +1,76 @@
+package qif
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+func TestWriteInvestments(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, "testISA", InvestmentAccountType, "02/01/2006")
+
+	err := w.WriteSecurities([]Security{
+		{Name: "Vanguard FTSE All-World", Symbol: "VWRL", Type: "Mutual Fund"},
+		{Name: "Apple Inc", Symbol: "AAPL", Type: "Stock"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WritePrices([]Price{
+		{Symbol: "VWRL", Price: 102.34, Date: time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = w.WriteInvestmentTransactions([]InvestmentTransaction{
+		{
+			Date:       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Action:     ActionBuy,
+			Security:   "Vanguard FTSE All-World",
+			Price:      100.5,
+			Quantity:   10.125,
+			Amount:     money.MustParse("1022.56", "GBP"),
+			Commission: money.MustParse("5", "GBP"),
+			Cleared:    Reconciled,
+		},
+		{
+			Date:     time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+			Action:   ActionDividend,
+			Security: "Apple Inc",
+			Amount:   money.MustParse("-3.20", "GBP"),
+			Memo:     "Q4 dividend",
+		},
+		{
+			Date:   time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC),
+			Action: ActionCashIn,
+			Amount: money.MustParse("-500", "GBP"),
+			Payee:  "Contribution",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join("testdata", "investment.qif")
+	if *updateGolden {
+		if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expect, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := out.String(); got != string(expect) {
+		t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+	}
+}
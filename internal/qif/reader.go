@@ -0,0 +1,336 @@
+package qif
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Account is an account read from a QIF, along with any transactions listed under it
+type Account struct {
+	Name         string
+	Type         string
+	Transactions []Transaction
+}
+
+// transactionTypes are the !Type: sections holding non-investment transactions
+var transactionTypes = map[string]bool{
+	"Bank":    true,
+	"Cash":    true,
+	"CCard":   true,
+	"Oth A":   true,
+	"Oth L":   true,
+	"Invoice": true,
+}
+
+// listTypes are the !Type: sections which Reader skips: lists rather than transactions, and investment transactions
+var listTypes = map[string]bool{
+	"Cat":                 true,
+	"Class":               true,
+	"Memorized":           true,
+	"Security":            true,
+	"Prices":              true,
+	InvestmentAccountType: true,
+}
+
+// Reader is not safe for concurrent use
+type Reader struct {
+	s          *bufio.Scanner
+	dateFormat string
+	currency   string
+	line       int
+
+	accounts []*Account
+	current  *Account
+	// section is the current !Type: or !Account section being read
+	section string
+	// typeStarted is true if a !Type: section has started since the current account was last switched to
+	typeStarted bool
+}
+
+// NewReader returns a Reader which is not safe for concurrent use.
+// QIFs don't record currency, so all amounts are read as the ISO 4217 currency provided.
+func NewReader(r io.Reader, dateFormat, currency string) *Reader {
+	return &Reader{
+		s:          bufio.NewScanner(r),
+		dateFormat: dateFormat,
+		currency:   currency,
+	}
+}
+
+// ReadAll reads every account and transaction from the QIF, in the order they first appear.
+// Transactions which appear before any account header are returned under an account with no name.
+func (r *Reader) ReadAll() ([]Account, error) {
+	var record []line
+
+	for r.s.Scan() {
+		r.line++
+		text := strings.TrimRight(r.s.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "!") {
+			if len(record) != 0 {
+				return nil, r.errorf(record[0].number, "record not terminated with '^' before '%s'", text)
+			}
+
+			if err := r.readHeader(strings.TrimSpace(text)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if text[0] != '^' {
+			record = append(record, line{number: r.line, code: text[0], value: text[1:]})
+			continue
+		}
+
+		if err := r.readRecord(record); err != nil {
+			return nil, err
+		}
+
+		record = record[:0]
+	}
+
+	if err := r.s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read qif: %w", err)
+	}
+
+	if len(record) != 0 {
+		return nil, r.errorf(record[0].number, "record not terminated with '^' before end of file")
+	}
+
+	accounts := make([]Account, 0, len(r.accounts))
+	for _, acct := range r.accounts {
+		accounts = append(accounts, *acct)
+	}
+
+	return accounts, nil
+}
+
+type line struct {
+	number int
+	code   byte
+	value  string
+}
+
+func (r *Reader) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("qif line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (r *Reader) readHeader(header string) error {
+	switch {
+	case header == "!Option:AutoSwitch" || header == "!Clear:AutoSwitch":
+		// every !Account record switches the current account anyway, so AutoSwitch needs no special handling
+		return nil
+	case header == "!Account":
+		r.section = header
+		return nil
+	case strings.HasPrefix(header, "!Type:"):
+		typ := strings.TrimSpace(strings.TrimPrefix(header, "!Type:"))
+		if !transactionTypes[typ] && !listTypes[typ] {
+			return r.errorf(r.line, "unsupported section '%s'", header)
+		}
+
+		r.section = "!Type:" + typ
+		if !transactionTypes[typ] {
+			return nil
+		}
+
+		// a second !Type: section without an account header in between is a different, unnamed account
+		if r.current == nil || r.typeStarted {
+			r.switchAccount("", typ)
+		}
+
+		r.typeStarted = true
+		if r.current.Type == "" {
+			r.current.Type = typ
+		}
+
+		return nil
+	default:
+		return r.errorf(r.line, "unsupported header '%s'", header)
+	}
+}
+
+func (r *Reader) switchAccount(name, typ string) {
+	r.typeStarted = false
+
+	if name != "" {
+		for _, acct := range r.accounts {
+			if acct.Name == name {
+				r.current = acct
+				return
+			}
+		}
+	}
+
+	r.current = &Account{Name: name, Type: typ}
+	r.accounts = append(r.accounts, r.current)
+}
+
+func (r *Reader) readRecord(record []line) error {
+	switch {
+	case r.section == "!Account":
+		return r.readAccount(record)
+	case listTypes[strings.TrimPrefix(r.section, "!Type:")]:
+		// records in list sections are skipped
+		return nil
+	case strings.HasPrefix(r.section, "!Type:"):
+		tx, err := r.readTransaction(record)
+		if err != nil {
+			return err
+		}
+
+		r.current.Transactions = append(r.current.Transactions, tx)
+		return nil
+	default:
+		return r.errorf(r.line, "record outside of any section")
+	}
+}
+
+func (r *Reader) readAccount(record []line) error {
+	var name, typ string
+	for _, l := range record {
+		switch l.code {
+		case 'N':
+			name = l.value
+		case 'T':
+			typ = l.value
+		case 'D', 'L', '/', '$':
+			// description, credit limit and balance are not kept
+		default:
+			return r.errorf(l.number, "unknown account field '%c'", l.code)
+		}
+	}
+
+	if name == "" {
+		return r.errorf(record[0].number, "account has no name")
+	}
+
+	r.switchAccount(name, typ)
+	if r.current.Type == "" {
+		r.current.Type = typ
+	}
+
+	return nil
+}
+
+func (r *Reader) readTransaction(record []line) (Transaction, error) {
+	var (
+		tx        Transaction
+		gotAmount bool
+		split     *Split
+	)
+
+	for _, l := range record {
+		switch l.code {
+		case 'D':
+			date, err := time.Parse(r.dateFormat, strings.TrimSpace(l.value))
+			if err != nil {
+				return Transaction{}, r.errorf(l.number, "invalid date '%s': %v", l.value, err)
+			}
+
+			tx.Date = date
+		case 'T', 'U':
+			// U is a duplicate of T written by newer versions of Quicken
+			if gotAmount {
+				continue
+			}
+
+			amount, err := parseAmount(l.value, r.currency)
+			if err != nil {
+				return Transaction{}, r.errorf(l.number, "invalid amount '%s': %v", l.value, err)
+			}
+
+			tx.Amount = amount
+			gotAmount = true
+		case 'P':
+			tx.Payee = l.value
+		case 'M':
+			tx.Memo = l.value
+		case 'N':
+			tx.Number = l.value
+		case 'C':
+			cleared, err := parseCleared(l.value)
+			if err != nil {
+				return Transaction{}, r.errorf(l.number, "%v", err)
+			}
+
+			tx.Cleared = cleared
+		case 'A':
+			tx.Address = append(tx.Address, l.value)
+		case 'L':
+			tx.Category, tx.Class = splitClass(l.value)
+		case 'S':
+			tx.Splits = append(tx.Splits, Split{Category: l.value})
+			split = &tx.Splits[len(tx.Splits)-1]
+		case 'E':
+			if split == nil {
+				return Transaction{}, r.errorf(l.number, "split memo before split category")
+			}
+
+			split.Memo = l.value
+		case '$':
+			if split == nil {
+				return Transaction{}, r.errorf(l.number, "split amount before split category")
+			}
+
+			amount, err := parseAmount(l.value, r.currency)
+			if err != nil {
+				return Transaction{}, r.errorf(l.number, "invalid split amount '%s': %v", l.value, err)
+			}
+
+			split.Amount = amount
+		case '%', 'F', 'K':
+			// split percentages, reimbursable flags and check flags are not kept
+		default:
+			return Transaction{}, r.errorf(l.number, "unknown transaction field '%c'", l.code)
+		}
+	}
+
+	if tx.Date.IsZero() {
+		return Transaction{}, r.errorf(record[0].number, "transaction has no date")
+	}
+
+	if !gotAmount {
+		return Transaction{}, r.errorf(record[0].number, "transaction has no amount")
+	}
+
+	return tx, nil
+}
+
+// parseAmount parses a QIF amount, negating it to match the sign convention of Transaction.Amount
+func parseAmount(s, currency string) (money.Amount, error) {
+	amount, err := money.Parse(strings.ReplaceAll(s, ",", ""), currency)
+	if err != nil {
+		return money.Amount{}, err
+	}
+
+	return amount.Neg(), nil
+}
+
+func parseCleared(s string) (ClearedStatus, error) {
+	switch strings.TrimSpace(s) {
+	case "":
+		return Uncleared, nil
+	case "*", "c":
+		return Cleared, nil
+	case "X", "R":
+		return Reconciled, nil
+	default:
+		return "", fmt.Errorf("unknown cleared status '%s'", s)
+	}
+}
+
+// splitClass splits an L field into its category and class, which follows the first '/'
+func splitClass(s string) (string, string) {
+	category, class, _ := strings.Cut(s, "/")
+	return category, class
+}
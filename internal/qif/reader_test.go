@@ -0,0 +1,219 @@
+package qif
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+func TestReadWriteRoundTrip(t *testing.T) {
+	transactions := []Transaction{
+		{
+			Date:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee:    "testPayee1",
+			Amount:   money.MustParse("10.26", "GBP"),
+			Memo:     "testMemo",
+			Category: "Groceries",
+			Cleared:  Cleared,
+			Splits: []Split{
+				{Category: "Groceries", Amount: money.MustParse("8.21", "GBP")},
+				{Category: "Household", Memo: "cleaning", Amount: money.MustParse("2.05", "GBP")},
+			},
+		},
+		{
+			Date:     time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			Payee:    "testPayee2",
+			Amount:   money.MustParse("-5001.67", "GBP"),
+			Category: "Salary",
+			Number:   "REF123",
+			Cleared:  Reconciled,
+			Address:  []string{"1 High Street", "London"},
+			Class:    "Business",
+		},
+	}
+
+	var out bytes.Buffer
+	w := NewWriter(&out, "testAcct", "CCard", "02/01/2006")
+	if err := w.WriteTransactions(transactions); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := NewReader(&out, "02/01/2006", "GBP").ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Account{{Name: "testAcct", Type: "CCard", Transactions: transactions}}
+	if !reflect.DeepEqual(accounts, expect) {
+		t.Fatalf("mismatch in accounts\nhave: %+v\nwant: %+v", accounts, expect)
+	}
+}
+
+func TestReadWriteRoundTripAmounts(t *testing.T) {
+	currencies := []string{"GBP", "USD", "JPY", "KWD"}
+
+	roundTrip := func(minor, splitMinor int64, currency uint8) bool {
+		cur := currencies[int(currency)%len(currencies)]
+		tx := Transaction{
+			Date:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee:  "testPayee",
+			Amount: money.New(minor/2+splitMinor/2, cur),
+			Splits: []Split{
+				{Category: "a", Amount: money.New(minor/2, cur)},
+				{Category: "b", Amount: money.New(splitMinor/2, cur)},
+			},
+		}
+
+		var out bytes.Buffer
+		if err := NewWriter(&out, "testAcct", "Bank", "02/01/2006").WriteTransaction(tx); err != nil {
+			t.Log(err)
+			return false
+		}
+
+		accounts, err := NewReader(&out, "02/01/2006", cur).ReadAll()
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		return len(accounts) == 1 && reflect.DeepEqual(accounts[0].Transactions, []Transaction{tx})
+	}
+
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadAutoSwitch(t *testing.T) {
+	in := `!Option:AutoSwitch
+!Account
+NCurrent
+TBank
+^
+NCredit Card
+TCCard
+^
+!Clear:AutoSwitch
+!Account
+NCredit Card
+TCCard
+^
+!Type:CCard
+D01/01/2020
+PtestPayee1
+T-10.26
+^
+!Account
+NCurrent
+TBank
+^
+!Type:Bank
+D02/01/2020
+U1,000.00
+T1,000.00
+PtestPayee2
+^
+!Type:Cat
+NGroceries
+E
+^
+`
+
+	accounts, err := NewReader(strings.NewReader(in), "02/01/2006", "GBP").ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Account{
+		{
+			Name: "Current",
+			Type: "Bank",
+			Transactions: []Transaction{
+				{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), Payee: "testPayee2", Amount: money.MustParse("-1000", "GBP")},
+			},
+		},
+		{
+			Name: "Credit Card",
+			Type: "CCard",
+			Transactions: []Transaction{
+				{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Payee: "testPayee1", Amount: money.MustParse("10.26", "GBP")},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(accounts, expect) {
+		t.Fatalf("mismatch in accounts\nhave: %+v\nwant: %+v", accounts, expect)
+	}
+}
+
+func TestReadNoAccountHeader(t *testing.T) {
+	in := "!Type:Bank\nD01/01/2020\nT-1.00\n^\n!Type:CCard\nD01/01/2020\nT-2.00\n^\n"
+
+	accounts, err := NewReader(strings.NewReader(in), "02/01/2006", "GBP").ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 2 || accounts[0].Type != "Bank" || accounts[1].Type != "CCard" {
+		t.Fatalf("expected two unnamed accounts, got %+v", accounts)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		Name   string
+		In     string
+		Expect string
+	}{
+		{
+			Name:   "BadDate",
+			In:     "!Type:Bank\nD2020-01-01\nT-1.00\n^\n",
+			Expect: "qif line 2: invalid date",
+		},
+		{
+			Name:   "BadAmount",
+			In:     "!Type:Bank\nD01/01/2020\nTabc\n^\n",
+			Expect: "qif line 3: invalid amount",
+		},
+		{
+			Name:   "UnknownField",
+			In:     "!Type:Bank\nD01/01/2020\nT-1.00\nZwhat\n^\n",
+			Expect: "qif line 4: unknown transaction field 'Z'",
+		},
+		{
+			Name:   "Unterminated",
+			In:     "!Type:Bank\nD01/01/2020\nT-1.00\n",
+			Expect: "qif line 2: record not terminated",
+		},
+		{
+			Name:   "NoSection",
+			In:     "D01/01/2020\nT-1.00\n^\n",
+			Expect: "qif line 3: record outside of any section",
+		},
+		{
+			Name:   "UnsupportedType",
+			In:     "!Type:Whatever\n",
+			Expect: "qif line 1: unsupported section",
+		},
+		{
+			Name:   "SplitMemoFirst",
+			In:     "!Type:Bank\nD01/01/2020\nT-1.00\nEmemo\n^\n",
+			Expect: "qif line 4: split memo before split category",
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tst.In), "02/01/2006", "GBP").ReadAll()
+			if err == nil || !strings.HasPrefix(err.Error(), tst.Expect) {
+				t.Fatalf("expected error starting '%s', got: %v", tst.Expect, err)
+			}
+		})
+	}
+}
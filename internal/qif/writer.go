@@ -1,10 +1,13 @@
 package qif
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"strconv"
 	"text/template"
 	"time"
+
+	"github.com/chill/plaidqif/internal/money"
 )
 
 // QIF spec: https://web.archive.org/web/20100222214101/http://web.intuit.com/support/quicken/docs/d_qif.html
@@ -15,7 +18,10 @@ type Writer struct {
 	dateFormat  string
 	header      header
 	wroteHeader bool
-	err         error
+	autoSwitch  bool
+	// wroteAny is true once anything has been written, so later headers must start on a new line
+	wroteAny bool
+	err      error
 }
 
 type header struct {
@@ -23,20 +29,62 @@ type header struct {
 	Type string
 }
 
+// ClearedStatus is the QIF cleared status of a transaction
+type ClearedStatus string
+
+const (
+	Uncleared  ClearedStatus = ""
+	Cleared    ClearedStatus = "*"
+	Reconciled ClearedStatus = "X"
+)
+
+// maxAddressLines is the number of address lines QIF allows, excluding the trailing message line
+const maxAddressLines = 5
+
 type Transaction struct {
-	Date   time.Time
-	Payee  string
-	Amount float64
-	Memo   string
+	Date     time.Time
+	Payee    string
+	Amount   money.Amount
+	Memo     string
+	Category string
+	// Number is the check or reference number
+	Number  string
+	Cleared ClearedStatus
+	// Address lines beyond the fifth are dropped
+	Address []string
+	Class   string
+	// Splits, if any, must sum to Amount
+	Splits []Split
+}
+
+// Split is part of a split transaction, its Amount has the same sign convention as Transaction.Amount
+type Split struct {
+	Category string
+	Memo     string
+	Amount   money.Amount
+}
+
+type split struct {
+	Category string
+	Memo     string
+	Amount   string
 }
 
 type transaction struct {
-	Date   string
-	Payee  string
-	Amount string
-	Memo   string
+	Date     string
+	Payee    string
+	Amount   string
+	Memo     string
+	Category string
+	Number   string
+	Cleared  string
+	Address  []string
+	Class    string
+	Splits   []split
 }
 
+const autoSwitchOption = "!Option:AutoSwitch"
+
 const headerFmt = `!Account
 N{{.Name}}
 T{{.Type}}
@@ -48,9 +96,28 @@ const txFmt = `
 D{{.Date}}
 P{{.Payee}}
 T{{.Amount}}
+{{- if .Cleared}}
+C{{.Cleared}}
+{{- end}}
+{{- if .Number}}
+N{{.Number}}
+{{- end}}
 {{- if .Memo}}
 M{{.Memo}}
 {{- end}}
+{{- range .Address}}
+A{{.}}
+{{- end}}
+{{- if or .Category .Class}}
+L{{.Category}}{{if .Class}}/{{.Class}}{{end}}
+{{- end}}
+{{- range .Splits}}
+S{{.Category}}
+{{- if .Memo}}
+E{{.Memo}}
+{{- end}}
+${{.Amount}}
+{{- end}}
 ^`
 
 var (
@@ -70,11 +137,41 @@ func NewWriter(w io.Writer, accountName, accountQIFType, dateFormat string) *Wri
 	}
 }
 
+// NewAutoSwitchWriter returns a Writer for writing transactions from many accounts to one QIF, using AutoSwitch.
+// SwitchAccount must be called before writing any transactions. The Writer is not safe for concurrent use.
+func NewAutoSwitchWriter(w io.Writer, dateFormat string) *Writer {
+	return &Writer{
+		w:          w,
+		dateFormat: dateFormat,
+		autoSwitch: true,
+	}
+}
+
+// SwitchAccount makes any further transactions written belong to a different account.
+// The account's header is only written along with its first transaction.
+func (w *Writer) SwitchAccount(accountName, accountQIFType string) {
+	next := header{Name: accountName, Type: accountQIFType}
+	if next == w.header {
+		return
+	}
+
+	w.header = next
+	w.wroteHeader = false
+}
+
 func (w *Writer) writeHeader() error {
 	if w.wroteHeader {
 		return nil
 	}
 
+	if w.header.Name == "" {
+		return errors.New("no account to write transactions to")
+	}
+
+	if err := w.writePrefix(); err != nil {
+		return err
+	}
+
 	w.wroteHeader = true
 	if err := headerTemplate.Execute(w.w, w.header); err != nil {
 		w.err = err
@@ -84,6 +181,25 @@ func (w *Writer) writeHeader() error {
 	return nil
 }
 
+// writePrefix writes whatever must precede a header or list: the AutoSwitch option at the start of the file,
+// or a newline to end the previous transaction or list otherwise
+func (w *Writer) writePrefix() error {
+	prefix := ""
+	if w.wroteAny {
+		prefix = "\n"
+	} else if w.autoSwitch {
+		prefix = autoSwitchOption + "\n"
+	}
+
+	w.wroteAny = true
+	if _, err := io.WriteString(w.w, prefix); err != nil {
+		w.err = err
+		return w.err
+	}
+
+	return nil
+}
+
 func (w *Writer) WriteTransactions(transactions []Transaction) error {
 	if w.err != nil {
 		return w.err
@@ -111,11 +227,32 @@ func (w *Writer) WriteTransaction(tx Transaction) error {
 }
 
 func (w *Writer) writeTransaction(tx Transaction) error {
+	if err := checkSplits(tx); err != nil {
+		return err
+	}
+
 	transaction := transaction{
-		Date:   tx.Date.Format(w.dateFormat),
-		Payee:  tx.Payee,
-		Amount: strconv.FormatFloat(-tx.Amount, 'f', 2, 64),
-		Memo:   tx.Memo,
+		Date:     tx.Date.Format(w.dateFormat),
+		Payee:    tx.Payee,
+		Amount:   tx.Amount.Neg().String(),
+		Memo:     tx.Memo,
+		Category: tx.Category,
+		Number:   tx.Number,
+		Cleared:  string(tx.Cleared),
+		Address:  tx.Address,
+		Class:    tx.Class,
+	}
+
+	if len(transaction.Address) > maxAddressLines {
+		transaction.Address = transaction.Address[:maxAddressLines]
+	}
+
+	for _, s := range tx.Splits {
+		transaction.Splits = append(transaction.Splits, split{
+			Category: s.Category,
+			Memo:     s.Memo,
+			Amount:   s.Amount.Neg().String(),
+		})
 	}
 
 	if err := txTemplate.Execute(w.w, transaction); err != nil {
@@ -125,3 +262,25 @@ func (w *Writer) writeTransaction(tx Transaction) error {
 
 	return nil
 }
+
+// checkSplits errors if a transaction has splits which don't add up to its amount exactly
+func checkSplits(tx Transaction) error {
+	if len(tx.Splits) == 0 {
+		return nil
+	}
+
+	total := money.New(0, tx.Amount.Currency)
+	for _, s := range tx.Splits {
+		var err error
+		if total, err = total.Add(s.Amount); err != nil {
+			return fmt.Errorf("splits for payee '%s' on %s: %w", tx.Payee, tx.Date.Format("2006-01-02"), err)
+		}
+	}
+
+	if total != tx.Amount {
+		return fmt.Errorf("splits for payee '%s' on %s sum to %s, but transaction amount is %s",
+			tx.Payee, tx.Date.Format("2006-01-02"), total.Neg(), tx.Amount.Neg())
+	}
+
+	return nil
+}
@@ -2,8 +2,14 @@ package qif
 
 import (
 	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/chill/plaidqif/internal/money"
 )
 
 func TestWriteHeader(t *testing.T) {
@@ -36,7 +42,7 @@ func TestWriteTransaction(t *testing.T) {
 			Tx: Transaction{
 				Date:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
 				Payee:  "testPayee",
-				Amount: 10.26,
+				Amount: money.MustParse("10.26", "GBP"),
 				Memo:   "abcdef",
 			},
 			Expect: `
@@ -44,6 +50,23 @@ D01/01/2020
 PtestPayee
 T-10.26
 Mabcdef
+^`,
+		},
+		{
+			Name: "WithCategory",
+			Tx: Transaction{
+				Date:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				Payee:    "testPayee",
+				Amount:   money.MustParse("10.26", "GBP"),
+				Memo:     "abcdef",
+				Category: "Food:Groceries",
+			},
+			Expect: `
+D01/01/2020
+PtestPayee
+T-10.26
+Mabcdef
+LFood:Groceries
 ^`,
 		},
 		{
@@ -51,7 +74,7 @@ Mabcdef
 			Tx: Transaction{
 				Date:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
 				Payee:  "testPayee",
-				Amount: 10.26,
+				Amount: money.MustParse("10.26", "GBP"),
 			},
 			Expect: `
 D01/01/2020
@@ -86,13 +109,13 @@ func TestWriteTransactions(t *testing.T) {
 		{
 			Date:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
 			Payee:  "testPayee1",
-			Amount: 10.26,
+			Amount: money.MustParse("10.26", "GBP"),
 			Memo:   "testMemo",
 		},
 		{
 			Date:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
 			Payee:  "testPayee2",
-			Amount: -5001.67,
+			Amount: money.MustParse("-5001.67", "GBP"),
 		},
 	})
 	if err != nil {
@@ -118,3 +141,176 @@ T5001.67
 		t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
 	}
 }
+
+func TestWriteAutoSwitch(t *testing.T) {
+	var out bytes.Buffer
+	w := NewAutoSwitchWriter(&out, "02/01/2006")
+
+	if err := w.WriteTransaction(Transaction{}); err == nil {
+		t.Fatal("expected error writing a transaction before switching to an account")
+	}
+
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.SwitchAccount("testAcct1", "CCard")
+	if err := w.WriteTransaction(Transaction{Date: date, Payee: "testPayee1", Amount: money.MustParse("10.26", "GBP")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// switching to an account with no transactions writes nothing
+	w.SwitchAccount("emptyAcct", "Bank")
+	w.SwitchAccount("testAcct2", "Bank")
+	if err := w.WriteTransaction(Transaction{Date: date, Payee: "testPayee2", Amount: money.MustParse("1.00", "GBP")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// switching to the current account is a noop
+	w.SwitchAccount("testAcct2", "Bank")
+	if err := w.WriteTransaction(Transaction{Date: date, Payee: "testPayee3", Amount: money.MustParse("2.00", "GBP")}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `!Option:AutoSwitch
+!Account
+NtestAcct1
+TCCard
+^
+!Type:CCard
+D01/01/2020
+PtestPayee1
+T-10.26
+^
+!Account
+NtestAcct2
+TBank
+^
+!Type:Bank
+D01/01/2020
+PtestPayee2
+T-1.00
+^
+D01/01/2020
+PtestPayee3
+T-2.00
+^`
+
+	if got := out.String(); got != expect {
+		t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+	}
+
+	accounts, err := NewReader(&out, "02/01/2006", "GBP").ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 2 || len(accounts[0].Transactions) != 1 || len(accounts[1].Transactions) != 2 {
+		t.Fatalf("unexpected accounts read back: %+v", accounts)
+	}
+}
+
+func TestWriteTransactionSplitsMismatch(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, "testAcct", "Bank", "02/01/2006")
+
+	err := w.WriteTransaction(Transaction{
+		Date:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Payee:  "testPayee",
+		Amount: money.MustParse("10.26", "GBP"),
+		Splits: []Split{
+			{Category: "Groceries", Amount: money.MustParse("8.21", "GBP")},
+			{Category: "Household", Amount: money.MustParse("2.04", "GBP")},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error for splits not summing to transaction amount")
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestWriteTransactionGolden(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		Name string
+		Tx   Transaction
+	}{
+		{
+			Name: "number",
+			Tx:   Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Number: "1042"},
+		},
+		{
+			Name: "cleared",
+			Tx:   Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Cleared: Cleared},
+		},
+		{
+			Name: "reconciled",
+			Tx:   Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Cleared: Reconciled},
+		},
+		{
+			Name: "address",
+			Tx: Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Address: []string{
+				"1 High Street", "London", "Greater London", "SW1A 1AA", "GB", "dropped",
+			}},
+		},
+		{
+			Name: "class",
+			Tx:   Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Class: "Business"},
+		},
+		{
+			Name: "category_class",
+			Tx:   Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Category: "Travel", Class: "Business"},
+		},
+		{
+			Name: "splits",
+			Tx: Transaction{Date: date, Payee: "testPayee", Amount: money.MustParse("10.26", "GBP"), Category: "Groceries", Splits: []Split{
+				{Category: "Groceries", Amount: money.MustParse("8.21", "GBP")},
+				{Category: "Household", Memo: "cleaning", Amount: money.MustParse("2.05", "GBP")},
+			}},
+		},
+		{
+			Name: "full",
+			Tx: Transaction{
+				Date:     date,
+				Payee:    "testPayee",
+				Amount:   money.MustParse("-5001.67", "GBP"),
+				Memo:     "testMemo",
+				Category: "Salary",
+				Number:   "REF123",
+				Cleared:  Reconciled,
+				Address:  []string{"1 High Street", "London"},
+				Class:    "Business",
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewWriter(&out, "testAcct", "Bank", "02/01/2006")
+
+			if err := w.writeTransaction(tst.Tx); err != nil {
+				t.Fatal(err)
+			}
+
+			// transactions start with a newline, which is awkward to keep in a golden file
+			got := strings.TrimPrefix(out.String(), "\n")
+			path := filepath.Join("testdata", tst.Name+".qif")
+
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(got), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != string(expect) {
+				t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Ways of applying rules
+const (
+	// First applies only the first rule that matches a transaction
+	First = "first"
+	// All applies every rule that matches a transaction in order, so later rules override earlier ones
+	All = "all"
+)
+
+// Syntaxes of rule patterns
+const (
+	Regexp = "regexp"
+	// Glob patterns match the whole value, case insensitively, with * matching any run of characters and ? any one
+	Glob = "glob"
+)
+
+// ruleSet is the on-disk representation of the rules
+type ruleSet struct {
+	// Apply is First or All, and defaults to First
+	Apply string
+	Rules []Rule
+}
+
+// Rule rewrites any transaction matching all of its patterns and amount range. Empty patterns match anything.
+type Rule struct {
+	// Rule names the rule when reporting which rules matched, and defaults to its position in the rules file
+	Rule string
+	// Syntax of the patterns is Regexp or Glob, and defaults to Regexp
+	Syntax string
+	// Name matches plaid's name of the transaction
+	Name string
+	// Merchant matches plaid's merchant name of the transaction, which is often empty
+	Merchant string
+	// Payee matches the payee of the transaction, as rewritten by any earlier rule
+	Payee string
+	// Account matches the name of the plaid account
+	Account string
+	// MinAmount and MaxAmount bound plaid's amount, inclusive, which is positive when money leaves the account.
+	// They are compared exactly, in the currency of the transaction.
+	MinAmount *float64
+	MaxAmount *float64
+	// Set holds the values to rewrite, leaving any which are empty unchanged
+	Set Rewrite
+
+	name     *regexp.Regexp
+	merchant *regexp.Regexp
+	payee    *regexp.Regexp
+	account  *regexp.Regexp
+}
+
+// Transaction holds the values of a transaction rules match against
+type Transaction struct {
+	Account  string
+	Name     string
+	Merchant string
+	Amount   money.Amount
+}
+
+// Rewrite holds the values of a transaction rules rewrite
+type Rewrite struct {
+	Payee    string
+	Memo     string
+	Category string
+}
+
+// Engine is safe for concurrent use, as it is never modified after construction
+type Engine struct {
+	apply string
+	rules []Rule
+}
+
+// NewEngine assumes confDir already exists. If there is no rules file, the returned Engine never rewrites anything.
+func NewEngine(confDir, filename string) (*Engine, error) {
+	if filename == "" {
+		filename = "rules.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var rs ruleSet
+	err := files.Unmarshal(path, "rules", &rs)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return nil, err
+	}
+
+	switch rs.Apply {
+	case "":
+		rs.Apply = First
+	case First, All:
+	default:
+		return nil, fmt.Errorf("unknown way to apply rules '%s' in '%s'", rs.Apply, path)
+	}
+
+	for i := range rs.Rules {
+		if rs.Rules[i].Rule == "" {
+			rs.Rules[i].Rule = fmt.Sprintf("#%d", i+1)
+		}
+
+		if err := rs.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule '%s' in '%s': %w", rs.Rules[i].Rule, path, err)
+		}
+	}
+
+	return &Engine{apply: rs.Apply, rules: rs.Rules}, nil
+}
+
+func (r *Rule) compile() error {
+	compile := regexp.Compile
+	switch r.Syntax {
+	case "", Regexp:
+	case Glob:
+		compile = compileGlob
+	default:
+		return fmt.Errorf("unknown pattern syntax '%s'", r.Syntax)
+	}
+
+	patterns := []struct {
+		kind    string
+		pattern string
+		re      **regexp.Regexp
+	}{
+		{"name", r.Name, &r.name},
+		{"merchant", r.Merchant, &r.merchant},
+		{"payee", r.Payee, &r.payee},
+		{"account", r.Account, &r.account},
+	}
+
+	for _, p := range patterns {
+		// empty patterns are left nil, matching anything
+		if p.pattern == "" {
+			continue
+		}
+
+		var err error
+		if *p.re, err = compile(p.pattern); err != nil {
+			return fmt.Errorf("invalid %s pattern '%s': %w", p.kind, p.pattern, err)
+		}
+	}
+
+	if r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount {
+		return fmt.Errorf("minimum amount %v is more than maximum amount %v", *r.MinAmount, *r.MaxAmount)
+	}
+
+	if r.Set == (Rewrite{}) {
+		return errors.New("nothing to set")
+	}
+
+	return nil
+}
+
+// compileGlob compiles a glob pattern to a case insensitive regular expression matching the whole value
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?i)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+func (r Rule) matches(tx Transaction, payee string) bool {
+	if r.MinAmount != nil && compareAmount(tx.Amount, *r.MinAmount) < 0 {
+		return false
+	}
+
+	if r.MaxAmount != nil && compareAmount(tx.Amount, *r.MaxAmount) > 0 {
+		return false
+	}
+
+	return matches(r.name, tx.Name) && matches(r.merchant, tx.Merchant) &&
+		matches(r.payee, payee) && matches(r.account, tx.Account)
+}
+
+// compareAmount returns -1, 0 or 1 as a is less than, equal to or more than bound, as an amount of a's currency
+func compareAmount(a money.Amount, bound float64) int {
+	b, err := money.FromFloat64(bound, a.Currency)
+	if err != nil {
+		// bounds too large to be an amount of the currency are beyond every amount
+		return -int(math.Copysign(1, bound))
+	}
+
+	switch {
+	case a.Minor < b.Minor:
+		return -1
+	case a.Minor > b.Minor:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func matches(re *regexp.Regexp, s string) bool {
+	return re == nil || re.MatchString(s)
+}
+
+// Apply rewrites the payee, memo and category of a transaction with the rules that match it,
+// returning the names of the rules applied in order
+func (e *Engine) Apply(tx Transaction, rw Rewrite) (Rewrite, []string) {
+	var applied []string
+	for _, r := range e.rules {
+		if !r.matches(tx, rw.Payee) {
+			continue
+		}
+
+		if r.Set.Payee != "" {
+			rw.Payee = r.Set.Payee
+		}
+
+		if r.Set.Memo != "" {
+			rw.Memo = r.Set.Memo
+		}
+
+		if r.Set.Category != "" {
+			rw.Category = r.Set.Category
+		}
+
+		applied = append(applied, r.Rule)
+		if e.apply == First {
+			break
+		}
+	}
+
+	return rw, applied
+}
@@ -0,0 +1,161 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+func TestEngine_Apply(t *testing.T) {
+	first, err := NewEngine("./", "test_rules.json")
+	if err != nil {
+		t.Fatalf("failed to setup rules engine: %v", err)
+	}
+
+	all, err := NewEngine("./", "test_rules_all.json")
+	if err != nil {
+		t.Fatalf("failed to setup rules engine: %v", err)
+	}
+
+	missing, err := NewEngine("./", "test_missing_rules.json")
+	if err != nil {
+		t.Fatalf("failed to setup rules engine: %v", err)
+	}
+
+	tests := []struct {
+		Name          string
+		Engine        *Engine
+		Tx            Transaction
+		Payee         string
+		Expect        Rewrite
+		ExpectApplied []string
+	}{
+		{
+			Name:          "FirstMatch",
+			Engine:        first,
+			Tx:            Transaction{Name: "AMZN Mktp UK*2K3L45", Amount: money.MustParse("12.99", "GBP")},
+			Payee:         "AMZN Mktp UK*2K3L45",
+			Expect:        Rewrite{Payee: "Amazon", Category: "Shopping"},
+			ExpectApplied: []string{"amazon"},
+		},
+		{
+			Name:          "Glob",
+			Engine:        first,
+			Tx:            Transaction{Name: "TFL TRAVEL CH", Amount: money.MustParse("2.8", "GBP")},
+			Payee:         "TFL TRAVEL CH",
+			Expect:        Rewrite{Payee: "Transport for London", Memo: "Travel", Category: "Transport"},
+			ExpectApplied: []string{"tfl"},
+		},
+		{
+			Name:   "GlobWholeValue",
+			Engine: first,
+			Tx:     Transaction{Name: "PAYMENT TFL TRAVEL CH", Amount: money.MustParse("2.8", "GBP")},
+			Payee:  "PAYMENT TFL TRAVEL CH",
+			Expect: Rewrite{Payee: "PAYMENT TFL TRAVEL CH"},
+		},
+		{
+			Name:          "MerchantAccountAmount",
+			Engine:        first,
+			Tx:            Transaction{Account: "My Credit Card", Name: "TESCO STORES 1234", Merchant: "Tesco", Amount: money.MustParse("120", "GBP")},
+			Payee:         "TESCO STORES 1234",
+			Expect:        Rewrite{Payee: "TESCO STORES 1234", Category: "Big Shop"},
+			ExpectApplied: []string{"big-tesco"},
+		},
+		{
+			Name:   "BelowMinAmount",
+			Engine: first,
+			Tx:     Transaction{Account: "My Credit Card", Name: "TESCO STORES 1234", Merchant: "Tesco", Amount: money.MustParse("20", "GBP")},
+			Payee:  "TESCO STORES 1234",
+			Expect: Rewrite{Payee: "TESCO STORES 1234"},
+		},
+		{
+			Name:   "AccountMismatch",
+			Engine: first,
+			Tx:     Transaction{Account: "Current Account", Name: "TESCO STORES 1234", Merchant: "Tesco", Amount: money.MustParse("120", "GBP")},
+			Payee:  "TESCO STORES 1234",
+			Expect: Rewrite{Payee: "TESCO STORES 1234"},
+		},
+		{
+			Name:          "UnnamedRule",
+			Engine:        first,
+			Tx:            Transaction{Name: "AMZN Digital", Amount: money.MustParse("5", "GBP")},
+			Payee:         "Amazon",
+			Expect:        Rewrite{Payee: "Amazon", Memo: "Second rule"},
+			ExpectApplied: []string{"#4"},
+		},
+		{
+			Name:          "AllMatch",
+			Engine:        all,
+			Tx:            Transaction{Name: "AMZN Mktp UK*2K3L45", Amount: money.MustParse("12.99", "GBP")},
+			Payee:         "AMZN Mktp UK*2K3L45",
+			Expect:        Rewrite{Payee: "Amazon", Memo: "Books", Category: "Books"},
+			ExpectApplied: []string{"amazon", "amazon-books"},
+		},
+		{
+			Name:          "AllMatchOne",
+			Engine:        all,
+			Tx:            Transaction{Name: "AMZN Mktp UK*2K3L45", Amount: money.MustParse("80", "GBP")},
+			Payee:         "AMZN Mktp UK*2K3L45",
+			Expect:        Rewrite{Payee: "Amazon", Category: "Shopping"},
+			ExpectApplied: []string{"amazon"},
+		},
+		{
+			Name:          "AtMinAmount",
+			Engine:        first,
+			Tx:            Transaction{Name: "RENT", Amount: money.MustParse("10.26", "GBP")},
+			Payee:         "RENT",
+			Expect:        Rewrite{Payee: "RENT", Category: "Rent"},
+			ExpectApplied: []string{"bounds"},
+		},
+		{
+			Name:          "AtMaxAmount",
+			Engine:        first,
+			Tx:            Transaction{Name: "RENT", Amount: money.MustParse("12.99", "GBP")},
+			Payee:         "RENT",
+			Expect:        Rewrite{Payee: "RENT", Category: "Rent"},
+			ExpectApplied: []string{"bounds"},
+		},
+		{
+			Name:   "JustBelowMinAmount",
+			Engine: first,
+			Tx:     Transaction{Name: "RENT", Amount: money.MustParse("10.25", "GBP")},
+			Payee:  "RENT",
+			Expect: Rewrite{Payee: "RENT"},
+		},
+		{
+			Name:   "JustAboveMaxAmount",
+			Engine: first,
+			Tx:     Transaction{Name: "RENT", Amount: money.MustParse("13.00", "GBP")},
+			Payee:  "RENT",
+			Expect: Rewrite{Payee: "RENT"},
+		},
+		{
+			Name:   "NoRules",
+			Engine: missing,
+			Tx:     Transaction{Name: "AMZN Mktp UK*2K3L45", Amount: money.MustParse("12.99", "GBP")},
+			Payee:  "AMZN Mktp UK*2K3L45",
+			Expect: Rewrite{Payee: "AMZN Mktp UK*2K3L45"},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			rw, applied := tst.Engine.Apply(tst.Tx, Rewrite{Payee: tst.Payee})
+			if rw != tst.Expect {
+				t.Fatalf("mismatch in rewrite\nhave: %+v\nwant: %+v", rw, tst.Expect)
+			}
+
+			if !reflect.DeepEqual(applied, tst.ExpectApplied) {
+				t.Fatalf("mismatch in rules applied\nhave: %v\nwant: %v", applied, tst.ExpectApplied)
+			}
+		})
+	}
+}
+
+func TestNewEngine_Invalid(t *testing.T) {
+	if _, err := NewEngine("./", "test_invalid_rules.json"); err == nil {
+		t.Fatalf("expected error loading rules with unknown syntax")
+	}
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TestRules lists the stored transactions between two dates, along with the payee rules that hit each of them
+// and what they were rewritten to, without contacting plaid or writing anything
+func (p *PlaidQIF) TestRules(institutionNames []string, fr, to string) error {
+	from, err := time.Parse(p.dateFormat, fr)
+	if err != nil {
+		return fmt.Errorf("cannot parse date to test rules from '%s': %w", fr, err)
+	}
+
+	until, err := time.Parse(p.dateFormat, to)
+	if err != nil {
+		return fmt.Errorf("cannot parse date to test rules until '%s': %w", to, err)
+	}
+
+	institutions, err := p.institutions.GetInstitutions(institutionNames)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Date\tInstitution\tAccount\tName\tAmount\tRules\tPayee\tMemo\tCategory\t")
+	fmt.Fprintln(tw, "----\t-----------\t-------\t----\t------\t-----\t-----\t----\t--------\t")
+
+	for _, ins := range institutions {
+		accounts, err := p.store.Accounts(ins.Name)
+		if err != nil {
+			return err
+		}
+
+		for _, acct := range accounts {
+			transactions, err := p.store.Transactions(acct.AccountId, from, until)
+			if err != nil {
+				return err
+			}
+
+			for _, tx := range transactions {
+				payee := tx.Name
+				if p := tx.PaymentMeta.Payee.Get(); p != nil {
+					payee = *p
+				}
+
+				date, err := time.Parse(plaidDateFormat, tx.Date)
+				if err != nil {
+					return fmt.Errorf("failed to parse transaction '%s' date '%s': %w", tx.TransactionId, tx.Date, err)
+				}
+
+				// rules see the amount just as they do when transactions are converted
+				original, amount, err := p.transactionAmount(tx, date)
+				if err != nil {
+					return fmt.Errorf("failed to convert transaction '%s' amount: %w", tx.TransactionId, err)
+				}
+
+				rw, applied, _, err := p.rewriteTransaction(acct, tx, payee, original, amount)
+				if err != nil {
+					return err
+				}
+
+				hit := "-"
+				if len(applied) != 0 {
+					hit = strings.Join(applied, ", ")
+				}
+
+				fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t", tx.Date, ins.Name, acct.Name,
+					tx.Name, amount.Neg(), hit, rw.Payee, rw.Memo, rw.Category))
+			}
+		}
+	}
+
+	return nil
+}
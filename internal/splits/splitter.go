@@ -0,0 +1,169 @@
+package splits
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/qif"
+)
+
+// Rule splits any transaction whose payee, and optionally account name, match its regular expressions
+type Rule struct {
+	Payee   string
+	Account string
+	Splits  []SplitRule
+
+	payee   *regexp.Regexp
+	account *regexp.Regexp
+}
+
+// SplitRule describes one part of a split. Fixed amounts are taken first, with the same sign as the transaction,
+// then percentages of the transaction amount. A SplitRule can't have both, and at most one may have neither,
+// which gets the remainder.
+type SplitRule struct {
+	Category string
+	Memo     string
+	Percent  float64
+	Amount   float64
+}
+
+// Splitter is safe for concurrent use, as it is never modified after construction
+type Splitter struct {
+	rules []Rule
+}
+
+// NewSplitter assumes confDir already exists. If there is no rules file, the returned Splitter never splits.
+func NewSplitter(confDir, filename string) (*Splitter, error) {
+	if filename == "" {
+		filename = "splits.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var rules []Rule
+	err := files.Unmarshal(path, "splits", &rules)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return nil, err
+	}
+
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid split rule %d in '%s': %w", i, path, err)
+		}
+	}
+
+	return &Splitter{rules: rules}, nil
+}
+
+func (r *Rule) compile() error {
+	var err error
+	if r.payee, err = regexp.Compile(r.Payee); err != nil {
+		return fmt.Errorf("invalid payee regexp '%s': %w", r.Payee, err)
+	}
+
+	if r.account, err = regexp.Compile(r.Account); err != nil {
+		return fmt.Errorf("invalid account regexp '%s': %w", r.Account, err)
+	}
+
+	if len(r.Splits) == 0 {
+		return errors.New("no splits")
+	}
+
+	var remainders int
+	for _, s := range r.Splits {
+		if s.Percent != 0 && s.Amount != 0 {
+			return fmt.Errorf("split to category '%s' has both an amount and a percent", s.Category)
+		}
+
+		if s.Percent == 0 && s.Amount == 0 {
+			remainders++
+		}
+	}
+
+	if remainders > 1 {
+		return errors.New("more than one split takes the remainder")
+	}
+
+	return nil
+}
+
+// Split returns the splits for a transaction from the first rule that matches it, or nil if none match.
+// It errors if the splits of the matching rule don't fit the transaction, such as fixed amounts larger than it.
+func (s *Splitter) Split(account string, tx qif.Transaction) ([]qif.Split, error) {
+	for _, r := range s.rules {
+		if !r.payee.MatchString(tx.Payee) || !r.account.MatchString(account) {
+			continue
+		}
+
+		splits, err := r.split(tx.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split transaction for payee '%s' with rule for payee '%s': %w", tx.Payee, r.Payee, err)
+		}
+
+		return splits, nil
+	}
+
+	return nil, nil
+}
+
+func (r Rule) split(total money.Amount) ([]qif.Split, error) {
+	amounts := make([]money.Amount, len(r.Splits))
+	remainder := -1
+	allocated := money.New(0, total.Currency)
+	for i, s := range r.Splits {
+		switch {
+		case s.Amount != 0:
+			fixed, err := money.FromFloat64(math.Abs(s.Amount), total.Currency)
+			if err != nil {
+				return nil, err
+			}
+
+			if total.Sign() < 0 {
+				fixed = fixed.Neg()
+			}
+
+			amounts[i] = fixed
+		case s.Percent != 0:
+			amounts[i] = total.Percent(s.Percent)
+		default:
+			amounts[i] = money.New(0, total.Currency)
+			remainder = i
+		}
+
+		var err error
+		if allocated, err = allocated.Add(amounts[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	left := money.New(total.Minor-allocated.Minor, total.Currency)
+	switch {
+	case remainder != -1 && left.Sign()*total.Sign() < 0:
+		return nil, fmt.Errorf("splits total %s, more than the transaction amount %s", allocated, total)
+	case remainder != -1:
+		amounts[remainder] = left
+	case left.Minor >= -int64(len(amounts)) && left.Minor <= int64(len(amounts)):
+		// with no remainder split, rounding differences of up to a minor unit per split go on the last split
+		last := len(amounts) - 1
+		amounts[last] = money.New(amounts[last].Minor+left.Minor, total.Currency)
+	default:
+		return nil, fmt.Errorf("splits total %s, but the transaction amount is %s", allocated, total)
+	}
+
+	splits := make([]qif.Split, 0, len(r.Splits))
+	for i, s := range r.Splits {
+		splits = append(splits, qif.Split{
+			Category: s.Category,
+			Memo:     s.Memo,
+			Amount:   amounts[i],
+		})
+	}
+
+	return splits, nil
+}
@@ -0,0 +1,133 @@
+package splits
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/qif"
+)
+
+func TestSplitter_Split(t *testing.T) {
+	s, err := NewSplitter("./", "test_splits.json")
+	if err != nil {
+		t.Fatalf("failed to setup splitter: %v", err)
+	}
+
+	tests := []struct {
+		Name    string
+		Account string
+		Tx      qif.Transaction
+		Expect  []qif.Split
+	}{
+		{
+			Name: "FixedPercentRemainder",
+			Tx:   qif.Transaction{Payee: "TESCO STORES 1234", Amount: money.MustParse("45.10", "GBP")},
+			Expect: []qif.Split{
+				{Category: "Household", Memo: "cleaning", Amount: money.MustParse("5", "GBP")},
+				{Category: "Alcohol", Amount: money.MustParse("4.51", "GBP")},
+				{Category: "Groceries", Amount: money.MustParse("35.59", "GBP")},
+			},
+		},
+		{
+			Name: "Refund",
+			Tx:   qif.Transaction{Payee: "Tesco", Amount: money.MustParse("-20", "GBP")},
+			Expect: []qif.Split{
+				{Category: "Household", Memo: "cleaning", Amount: money.MustParse("-5", "GBP")},
+				{Category: "Alcohol", Amount: money.MustParse("-2", "GBP")},
+				{Category: "Groceries", Amount: money.MustParse("-13", "GBP")},
+			},
+		},
+		{
+			Name:    "PercentRounding",
+			Account: "My Credit Card",
+			Tx:      qif.Transaction{Payee: "Amazon", Amount: money.MustParse("10", "GBP")},
+			Expect: []qif.Split{
+				{Category: "Books", Amount: money.MustParse("3.33", "GBP")},
+				{Category: "Electronics", Amount: money.MustParse("6.67", "GBP")},
+			},
+		},
+		{
+			Name:    "AccountMismatch",
+			Account: "Current Account",
+			Tx:      qif.Transaction{Payee: "Amazon", Amount: money.MustParse("10", "GBP")},
+		},
+		{
+			Name: "NoMatch",
+			Tx:   qif.Transaction{Payee: "Sainsburys", Amount: money.MustParse("10", "GBP")},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			got, err := s.Split(tst.Account, tst.Tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tst.Expect) {
+				t.Fatalf("mismatch in splits\nhave: %+v\nwant: %+v", got, tst.Expect)
+			}
+		})
+	}
+}
+
+func TestSplitter_SplitTooLarge(t *testing.T) {
+	s, err := NewSplitter("./", "test_splits.json")
+	if err != nil {
+		t.Fatalf("failed to setup splitter: %v", err)
+	}
+
+	// the fixed £5 and 10% add up to more than the £5.50 transaction
+	if _, err := s.Split("", qif.Transaction{Payee: "Tesco", Amount: money.MustParse("5.50", "GBP")}); err == nil {
+		t.Fatal("expected error for splits larger than the transaction")
+	}
+}
+
+func TestRule_Compile(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Splits []SplitRule
+		Err    string
+	}{
+		{
+			Name:   "Valid",
+			Splits: []SplitRule{{Category: "Household", Amount: 5}, {Category: "Alcohol", Percent: 10}, {Category: "Groceries"}},
+		},
+		{
+			Name: "NoSplits",
+			Err:  "no splits",
+		},
+		{
+			Name:   "AmountAndPercent",
+			Splits: []SplitRule{{Category: "Household", Amount: 5, Percent: 10}, {Category: "Groceries"}},
+			Err:    "both an amount and a percent",
+		},
+		{
+			Name:   "TwoRemainders",
+			Splits: []SplitRule{{Category: "Household"}, {Category: "Groceries"}},
+			Err:    "more than one split takes the remainder",
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			r := Rule{Payee: "(?i)^tesco", Splits: tst.Splits}
+			err := r.compile()
+			if tst.Err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tst.Err) {
+				t.Fatalf("expected error containing '%s', got: %v", tst.Err, err)
+			}
+		})
+	}
+}
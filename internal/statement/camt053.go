@@ -0,0 +1,218 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// camt.053 schema: https://www.iso20022.org/message/mdr/22701/download
+
+const camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+const (
+	isoDate     = "2006-01-02"
+	isoDateTime = "2006-01-02T15:04:05"
+)
+
+// the structs below only hold the elements written, in schema order
+
+type camtDocument struct {
+	XMLName xml.Name      `xml:"Document"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Stmts   camtStatement `xml:"BkToCstmrStmt"`
+}
+
+type camtStatement struct {
+	GrpHdr camtGroupHeader `xml:"GrpHdr"`
+	Stmt   []camtStmt      `xml:"Stmt"`
+}
+
+type camtGroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camtStmt struct {
+	Id      string        `xml:"Id"`
+	CreDtTm string        `xml:"CreDtTm"`
+	FrToDt  camtFromTo    `xml:"FrToDt"`
+	Acct    camtAccount   `xml:"Acct"`
+	Bal     []camtBalance `xml:"Bal"`
+	Ntry    []camtEntry   `xml:"Ntry"`
+}
+
+type camtFromTo struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camtAccount struct {
+	Id   string        `xml:"Id>Othr>Id"`
+	Ccy  string        `xml:"Ccy,omitempty"`
+	Nm   string        `xml:"Nm,omitempty"`
+	Svcr *camtServicer `xml:"Svcr,omitempty"`
+}
+
+type camtServicer struct {
+	Nm string `xml:"FinInstnId>Nm"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Cd        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Dt        string     `xml:"Dt>Dt"`
+}
+
+type camtEntry struct {
+	NtryRef      string          `xml:"NtryRef"`
+	Amt          camtAmount      `xml:"Amt"`
+	CdtDbtInd    string          `xml:"CdtDbtInd"`
+	Sts          string          `xml:"Sts"`
+	BookgDt      string          `xml:"BookgDt>Dt"`
+	ValDt        string          `xml:"ValDt>Dt"`
+	AcctSvcrRef  string          `xml:"AcctSvcrRef"`
+	BkTxCd       string          `xml:"BkTxCd>Prtry>Cd"`
+	TxDtls       camtTransaction `xml:"NtryDtls>TxDtls"`
+	AddtlNtryInf string          `xml:"AddtlNtryInf,omitempty"`
+}
+
+type camtTransaction struct {
+	AcctSvcrRef string          `xml:"Refs>AcctSvcrRef"`
+	Cdtr        *camtParty      `xml:"RltdPties>Cdtr,omitempty"`
+	Dbtr        *camtParty      `xml:"RltdPties>Dbtr,omitempty"`
+	RmtInf      *camtRemittance `xml:"RmtInf,omitempty"`
+}
+
+type camtRemittance struct {
+	Ustrd string `xml:"Ustrd"`
+}
+
+type camtParty struct {
+	Nm string `xml:"Nm"`
+}
+
+func (w *Writer) writeCamt053(statements []Statement) error {
+	created := w.now().UTC().Format(isoDateTime)
+	doc := camtDocument{
+		Xmlns: camt053Namespace,
+		Stmts: camtStatement{
+			GrpHdr: camtGroupHeader{
+				MsgId:   "PLAIDQIF" + w.now().UTC().Format("20060102150405"),
+				CreDtTm: created,
+			},
+		},
+	}
+
+	for _, s := range statements {
+		stmt := camtStmt{
+			Id:      s.ID,
+			CreDtTm: created,
+			FrToDt: camtFromTo{
+				FrDtTm: s.Start.Format(isoDate) + "T00:00:00",
+				ToDtTm: s.End.Format(isoDate) + "T23:59:59",
+			},
+			Acct: camtAccount{
+				Id:  s.AccountID,
+				Ccy: strings.ToUpper(s.Currency),
+				Nm:  s.AccountName,
+			},
+			Bal: []camtBalance{
+				camtBal("OPBD", s.OpeningBalance, s.Start),
+				camtBal("CLBD", s.ClosingBalance, s.End),
+			},
+		}
+
+		if s.Institution != "" {
+			stmt.Acct.Svcr = &camtServicer{Nm: s.Institution}
+		}
+
+		for _, e := range s.Entries {
+			stmt.Ntry = append(stmt.Ntry, camtNtry(e))
+		}
+
+		doc.Stmts.Stmt = append(doc.Stmts.Stmt, stmt)
+	}
+
+	if _, err := io.WriteString(w.w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write camt.053: %w", err)
+	}
+
+	enc := xml.NewEncoder(w.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write camt.053: %w", err)
+	}
+
+	if _, err := io.WriteString(w.w, "\n"); err != nil {
+		return fmt.Errorf("failed to write camt.053: %w", err)
+	}
+
+	return nil
+}
+
+func camtBal(code string, balance money.Amount, date time.Time) camtBalance {
+	amount, indicator := creditDebit(balance)
+	return camtBalance{
+		Cd:        code,
+		Amt:       camtAmount{Ccy: strings.ToUpper(balance.Currency), Value: amount.String()},
+		CdtDbtInd: indicator,
+		Dt:        date.Format(isoDate),
+	}
+}
+
+func camtNtry(e Entry) camtEntry {
+	amount, indicator := creditDebit(e.Amount)
+	status := "BOOK"
+	if e.Pending {
+		status = "PDNG"
+	}
+
+	ntry := camtEntry{
+		NtryRef:     e.Reference,
+		Amt:         camtAmount{Ccy: strings.ToUpper(e.Amount.Currency), Value: amount.String()},
+		CdtDbtInd:   indicator,
+		Sts:         status,
+		BookgDt:     e.Booked.Format(isoDate),
+		ValDt:       e.Booked.Format(isoDate),
+		AcctSvcrRef: e.Reference,
+		// plaid doesn't say how a transaction was made, so use the proprietary code for miscellaneous
+		BkTxCd:       "NMSC",
+		TxDtls:       camtTransaction{AcctSvcrRef: e.Reference},
+		AddtlNtryInf: e.Name,
+	}
+
+	if e.Info != "" {
+		ntry.TxDtls.RmtInf = &camtRemittance{Ustrd: e.Info}
+	}
+
+	// the other party is the creditor when money leaves the account, and the debtor when it enters
+	if e.Name != "" {
+		if indicator == "DBIT" {
+			ntry.TxDtls.Cdtr = &camtParty{Nm: e.Name}
+		} else {
+			ntry.TxDtls.Dbtr = &camtParty{Nm: e.Name}
+		}
+	}
+
+	return ntry
+}
+
+// creditDebit returns the unsigned amount, and whether it's a credit or debit
+func creditDebit(a money.Amount) (money.Amount, string) {
+	if a.Sign() < 0 {
+		return a.Neg(), "DBIT"
+	}
+
+	return a, "CRDT"
+}
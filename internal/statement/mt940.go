@@ -0,0 +1,136 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// MT940 spec: https://www2.swift.com/knowledgecentre/publications/usgf_20230720/2.0?topic=mt940.htm
+
+const (
+	mt940Date      = "060102"
+	mt940EntryDate = "0102"
+	// mt940InfoLines and mt940InfoWidth limit the size of :86: information to account owner
+	mt940InfoLines = 6
+	mt940InfoWidth = 65
+)
+
+func (w *Writer) writeMT940(statements []Statement) error {
+	var sb strings.Builder
+	for i, s := range statements {
+		writeMT940Statement(&sb, i+1, s)
+	}
+
+	if _, err := io.WriteString(w.w, sb.String()); err != nil {
+		return fmt.Errorf("failed to write mt940: %w", err)
+	}
+
+	return nil
+}
+
+func writeMT940Statement(sb *strings.Builder, number int, s Statement) {
+	field(sb, "20", truncate(swiftChars(s.ID), 16))
+	field(sb, "25", truncate(swiftChars(s.AccountID), 35))
+	field(sb, "28C", fmt.Sprintf("%d/1", number))
+	field(sb, "60F", mt940Balance(s.OpeningBalance, s.Start.Format(mt940Date)))
+
+	for _, e := range s.Entries {
+		if e.Pending {
+			continue
+		}
+
+		amount, mark := mt940CreditDebit(e.Amount)
+		// value date, entry date, mark, amount, then a miscellaneous transaction type, the account owner's
+		// reference and the bank's reference, both of which are limited to 16 characters
+		ref := truncate(swiftChars(e.Reference), 16)
+		field(sb, "61", fmt.Sprintf("%s%s%s%sNMSC%s//%s",
+			e.Booked.Format(mt940Date), e.Booked.Format(mt940EntryDate), mark, mt940Amount(amount), ref, ref))
+
+		// the full reference is kept in the information to account owner
+		info := "/TRID/" + e.Reference
+		if e.Name != "" {
+			info += "/NAME/" + e.Name
+		}
+
+		if e.Info != "" {
+			info += "/REMI/" + e.Info
+		}
+
+		// colons would start a new field if they were wrapped onto the start of a line
+		info = strings.ReplaceAll(swiftChars(info), ":", " ")
+		field(sb, "86", strings.Join(wrap(info, mt940InfoWidth, mt940InfoLines), "\r\n"))
+	}
+
+	field(sb, "62F", mt940Balance(s.ClosingBalance, s.End.Format(mt940Date)))
+	sb.WriteString("-\r\n")
+}
+
+func field(sb *strings.Builder, tag, value string) {
+	sb.WriteString(":" + tag + ":" + value + "\r\n")
+}
+
+func mt940Balance(balance money.Amount, date string) string {
+	amount, mark := mt940CreditDebit(balance)
+	return mark + date + strings.ToUpper(balance.Currency) + mt940Amount(amount)
+}
+
+func mt940CreditDebit(a money.Amount) (money.Amount, string) {
+	if a.Sign() < 0 {
+		return a.Neg(), "D"
+	}
+
+	return a, "C"
+}
+
+// mt940Amount formats an unsigned amount with a decimal comma, which is required even if there are no decimals
+func mt940Amount(a money.Amount) string {
+	s := strings.Replace(a.String(), ".", ",", 1)
+	if !strings.Contains(s, ",") {
+		s += ","
+	}
+
+	return s
+}
+
+// swiftChars replaces any characters outside of the SWIFT X character set with spaces
+func swiftChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			return r
+		default:
+			return ' '
+		}
+	}, s)
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+// wrap splits s into at most maxLines lines of width characters, dropping anything beyond them
+func wrap(s string, width, maxLines int) []string {
+	var lines []string
+	runes := []rune(s)
+	for len(runes) > 0 && len(lines) < maxLines {
+		n := width
+		if len(runes) < n {
+			n = len(runes)
+		}
+
+		lines = append(lines, string(runes[:n]))
+		runes = runes[n:]
+	}
+
+	return lines
+}
@@ -0,0 +1,78 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Format is the bank statement format to write
+type Format string
+
+const (
+	// Camt053 is ISO 20022 BankToCustomerStatement XML, version camt.053.001.02
+	Camt053 Format = "camt053"
+	// MT940 is the SWIFT customer statement message
+	MT940 Format = "mt940"
+)
+
+// Statement is the statement of one account over a date range
+type Statement struct {
+	// ID identifies the statement, MT940 only keeps the first 16 characters
+	ID          string
+	AccountID   string
+	AccountName string
+	Institution string
+	Currency    string
+	Start       time.Time
+	End         time.Time
+	// OpeningBalance and ClosingBalance are positive when in credit
+	OpeningBalance money.Amount
+	ClosingBalance money.Amount
+	Entries        []Entry
+}
+
+// Entry is a transaction on a statement
+type Entry struct {
+	// Reference uniquely identifies the entry
+	Reference string
+	Booked    time.Time
+	// Amount is positive when money enters the account
+	Amount money.Amount
+	// Pending entries are written with camt.053 status PDNG, and left out of MT940 statements,
+	// which only hold booked entries
+	Pending bool
+	// Name is the other party to the entry
+	Name string
+	Info string
+}
+
+// Writer is not safe for concurrent use
+type Writer struct {
+	w      io.Writer
+	format Format
+	now    func() time.Time
+}
+
+// NewWriter returns a Writer which is not safe for concurrent use
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{
+		w:      w,
+		format: format,
+		now:    time.Now,
+	}
+}
+
+// WriteStatements writes a complete camt.053 document, or MT940 file, containing all of the statements
+func (w *Writer) WriteStatements(statements []Statement) error {
+	switch w.format {
+	case Camt053:
+		return w.writeCamt053(statements)
+	case MT940:
+		return w.writeMT940(statements)
+	default:
+		return fmt.Errorf("unknown statement format '%s'", w.format)
+	}
+}
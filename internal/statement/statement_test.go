@@ -0,0 +1,100 @@
+package statement
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func testStatements() []Statement {
+	return []Statement{
+		{
+			ID:             "PLAIDQIF200131",
+			AccountID:      "acct-current",
+			AccountName:    "Current Account",
+			Institution:    "monzo",
+			Currency:       "gbp",
+			Start:          time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:            time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+			OpeningBalance: money.MustParse("-4000", "GBP"),
+			ClosingBalance: money.MustParse("991.41", "GBP"),
+			Entries: []Entry{
+				{
+					Reference: "BxBXxLj1m4HMXBm9WZZmCWVbPjX16EHwv99vp",
+					Booked:    time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+					Amount:    money.MustParse("-10.26", "GBP"),
+					Name:      "Marks & Spencer <Food>",
+					Info:      "Groceries: milk",
+				},
+				{
+					Reference: "tx-2",
+					Booked:    time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+					Amount:    money.MustParse("5001.67", "GBP"),
+					Name:      "Employer",
+				},
+				{
+					Reference: "tx-3",
+					Booked:    time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+					Amount:    money.MustParse("-1.50", "GBP"),
+					Pending:   true,
+					Name:      "Coffee",
+				},
+			},
+		},
+		{
+			ID:             "PLAIDQIF200131",
+			AccountID:      "acct-yen",
+			Currency:       "JPY",
+			Start:          time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:            time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC),
+			OpeningBalance: money.MustParse("100", "JPY"),
+			ClosingBalance: money.MustParse("100", "JPY"),
+		},
+	}
+}
+
+func TestWriteStatements(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Format Format
+	}{
+		{Name: "camt053.xml", Format: Camt053},
+		{Name: "statements.sta", Format: MT940},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewWriter(&out, tst.Format)
+			w.now = func() time.Time { return time.Date(2020, 2, 1, 12, 30, 0, 0, time.UTC) }
+
+			if err := w.WriteStatements(testStatements()); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tst.Name)
+			if *updateGolden {
+				if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.String(); got != string(expect) {
+				t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/money"
+	"github.com/chill/plaidqif/internal/statement"
+)
+
+var statementExtensions = map[statement.Format]string{
+	statement.Camt053: "xml",
+	statement.MT940:   "sta",
+}
+
+// accountStatement collects the entries of an account, until its balances can be worked out on Close
+type accountStatement struct {
+	institution string
+	acct        plaid.AccountBase
+	entries     []statement.Entry
+}
+
+type statementFile struct {
+	path     string
+	accounts []*accountStatement
+}
+
+// statementFiles builds a bank statement for each account, writing them all out on Close, one file per account
+// unless combining them. statementFiles is not safe for concurrent use.
+type statementFiles struct {
+	opts     OutputOptions
+	format   statement.Format
+	from     time.Time
+	until    time.Time
+	files    map[string]*statementFile
+	accounts map[string]*accountStatement
+	order    []string
+}
+
+func newStatementFiles(opts OutputOptions, format statement.Format, from, until time.Time) (*statementFiles, error) {
+	opts, err := validateOutputOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !balancesAreCurrent(until) {
+		fmt.Printf("Statement balances are current balances, which may include transactions after the download\n")
+	}
+
+	return &statementFiles{
+		opts:     opts,
+		format:   format,
+		from:     from,
+		until:    until,
+		files:    make(map[string]*statementFile),
+		accounts: make(map[string]*accountStatement),
+	}, nil
+}
+
+func (s *statementFiles) destination(institution string, acct plaid.AccountBase) string {
+	path, _ := outputPath(s.opts, institution, acct, statementExtensions[s.format])
+	return path
+}
+
+// writeTransactions adds the entries of an account to its statement, which is written even if there are none,
+// to give the account's balance
+func (s *statementFiles) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	as, ok := s.accounts[acct.AccountId]
+	if !ok {
+		as = &accountStatement{institution: institution, acct: acct}
+		s.accounts[acct.AccountId] = as
+
+		path, _ := outputPath(s.opts, institution, acct, statementExtensions[s.format])
+		sf, ok := s.files[path]
+		if !ok {
+			sf = &statementFile{path: path}
+			s.files[path] = sf
+			s.order = append(s.order, path)
+		}
+
+		sf.accounts = append(sf.accounts, as)
+	}
+
+	for _, tx := range transactions {
+		as.entries = append(as.entries, statement.Entry{
+			Reference: tx.source.TransactionId,
+			Booked:    tx.Date,
+			// statement amounts are positive when money enters the account, the opposite of plaid, and are in the
+			// account's currency, so are never converted to the reporting currency
+			Amount:  tx.original.Neg(),
+			Pending: tx.source.Pending,
+			Name:    tx.Payee,
+			Info:    tx.Memo,
+		})
+	}
+
+	return nil
+}
+
+// statement works out the opening balance of an account from its current balance and the entries booked since
+func (s *statementFiles) statement(as *accountStatement) (statement.Statement, error) {
+	current := as.acct.Balances.Current.Get()
+	if current == nil {
+		return statement.Statement{}, fmt.Errorf("institution '%s' has no current balance for account '%s'", as.institution, as.acct.Name)
+	}
+
+	currency := currencyCode(as.acct.Balances.IsoCurrencyCode, as.acct.Balances.UnofficialCurrencyCode)
+	closing, err := money.FromFloat32(*current, currency)
+	if err != nil {
+		return statement.Statement{}, fmt.Errorf("failed to convert current balance of account '%s': %w", as.acct.Name, err)
+	}
+
+	// plaid balances of credit and loan accounts are positive when money is owed
+	if isLiabilityAccount(as.acct) {
+		closing = closing.Neg()
+	}
+
+	opening := closing
+	for _, e := range as.entries {
+		if e.Pending {
+			continue
+		}
+
+		if opening, err = opening.Add(e.Amount.Neg()); err != nil {
+			return statement.Statement{}, fmt.Errorf("failed to work out opening balance of account '%s': %w", as.acct.Name, err)
+		}
+	}
+
+	return statement.Statement{
+		ID:             "PLAIDQIF" + s.until.Format("060102"),
+		AccountID:      as.acct.AccountId,
+		AccountName:    as.acct.Name,
+		Institution:    as.institution,
+		Currency:       currency,
+		Start:          s.from,
+		End:            s.until,
+		OpeningBalance: opening,
+		ClosingBalance: closing,
+		Entries:        as.entries,
+	}, nil
+}
+
+// Close writes out every statement file, returning the first error encountered
+func (s *statementFiles) Close() error {
+	var firstErr error
+	for _, path := range s.order {
+		if err := s.writeFile(s.files[path]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	s.files = make(map[string]*statementFile)
+	s.accounts = make(map[string]*accountStatement)
+	s.order = nil
+	return firstErr
+}
+
+func (s *statementFiles) writeFile(sf *statementFile) error {
+	statements := make([]statement.Statement, 0, len(sf.accounts))
+	for _, as := range sf.accounts {
+		st, err := s.statement(as)
+		if err != nil {
+			return err
+		}
+
+		statements = append(statements, st)
+	}
+
+	f, err := files.OpenWriter(sf.path, string(s.format))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := statement.NewWriter(f, s.format).WriteStatements(statements); err != nil {
+		return fmt.Errorf("failed to write %s file '%s': %w", s.format, sf.path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s file '%s': %w", s.format, sf.path, err)
+	}
+
+	return nil
+}
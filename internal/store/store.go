@@ -0,0 +1,402 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/learned"
+
+	// registers the pure go "sqlite" database/sql driver, so no cgo is needed
+	_ "modernc.org/sqlite"
+)
+
+const dateFormat = "2006-01-02"
+
+// schema is idempotent, so it can be applied every time the store is opened.
+// Accounts and transactions are kept as plaid returned them, with the fields they're queried by alongside.
+const schema = `
+CREATE TABLE IF NOT EXISTS accounts (
+	account_id TEXT PRIMARY KEY NOT NULL,
+	institution TEXT NOT NULL,
+	name TEXT NOT NULL,
+	data TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+	transaction_id TEXT PRIMARY KEY NOT NULL,
+	account_id TEXT NOT NULL,
+	institution TEXT NOT NULL,
+	date TEXT NOT NULL,
+	pending INTEGER NOT NULL,
+	pending_transaction_id TEXT,
+	-- posted_transaction_id is set on pending transactions once plaid posts them as another transaction
+	posted_transaction_id TEXT,
+	posted_at TEXT,
+	removed INTEGER NOT NULL DEFAULT 0,
+	first_seen TEXT NOT NULL,
+	updated TEXT NOT NULL,
+	data TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS transactions_account_date ON transactions (account_id, date);
+CREATE INDEX IF NOT EXISTS transactions_pending_transaction_id ON transactions (pending_transaction_id);
+
+-- category_observations holds the categories given to payees, which categories are learned from
+CREATE TABLE IF NOT EXISTS category_observations (
+	key TEXT PRIMARY KEY NOT NULL,
+	source TEXT NOT NULL,
+	payee TEXT NOT NULL,
+	category TEXT NOT NULL,
+	amount_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	observed_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS category_observations_payee ON category_observations (payee);
+
+-- pending_reports holds the pending transactions which have already been reported as posted or removed
+CREATE TABLE IF NOT EXISTS pending_reports (
+	transaction_id TEXT PRIMARY KEY NOT NULL,
+	reported_at TEXT NOT NULL
+);
+`
+
+// Store keeps every account and transaction fetched from plaid, so they can be exported again without plaid
+type Store struct {
+	path string
+	db   *sql.DB
+	now  func() time.Time
+}
+
+// Open assumes confDir already exists, creating the store in it if it doesn't exist yet
+func Open(confDir, filename string) (*Store, error) {
+	if filename == "" {
+		filename = "transactions.db"
+	}
+
+	path := filepath.Join(confDir, filename)
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transaction store '%s': %w", path, err)
+	}
+
+	// sqlite only allows one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create transaction store '%s': %w", path, err)
+	}
+
+	return &Store{
+		path: path,
+		db:   db,
+		now:  time.Now,
+	}, nil
+}
+
+// PutAccounts adds or updates accounts of an institution
+func (s *Store) PutAccounts(institution string, accounts []plaid.AccountBase) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, acct := range accounts {
+			data, err := json.Marshal(acct)
+			if err != nil {
+				return fmt.Errorf("failed to marshal account '%s': %w", acct.Name, err)
+			}
+
+			if _, err := tx.Exec(`INSERT INTO accounts (account_id, institution, name, data) VALUES (?, ?, ?, ?)
+				ON CONFLICT (account_id) DO UPDATE SET institution = excluded.institution, name = excluded.name, data = excluded.data`,
+				acct.AccountId, institution, acct.Name, string(data)); err != nil {
+				return fmt.Errorf("failed to store account '%s': %w", acct.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// PutTransactions adds or updates transactions of an institution. Any pending transactions which
+// the transactions are the posted versions of are marked as posted.
+func (s *Store) PutTransactions(institution string, transactions []plaid.Transaction) error {
+	now := s.now().UTC().Format(time.RFC3339)
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, t := range transactions {
+			data, err := json.Marshal(t)
+			if err != nil {
+				return fmt.Errorf("failed to marshal transaction '%s': %w", t.TransactionId, err)
+			}
+
+			var pendingID *string
+			if id := t.PendingTransactionId.Get(); id != nil && *id != "" {
+				pendingID = id
+			}
+
+			if _, err := tx.Exec(`INSERT INTO transactions (transaction_id, account_id, institution, date, pending,
+				pending_transaction_id, first_seen, updated, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (transaction_id) DO UPDATE SET account_id = excluded.account_id, date = excluded.date,
+				pending = excluded.pending, pending_transaction_id = excluded.pending_transaction_id, removed = 0,
+				updated = excluded.updated, data = excluded.data`,
+				t.TransactionId, t.AccountId, institution, t.Date, t.Pending, pendingID, now, now, string(data)); err != nil {
+				return fmt.Errorf("failed to store transaction '%s': %w", t.TransactionId, err)
+			}
+
+			if t.Pending {
+				// plaid may have returned the posted transaction first
+				if _, err := tx.Exec(`UPDATE transactions SET posted_at = ?,
+					posted_transaction_id = (SELECT p.transaction_id FROM transactions p WHERE p.pending_transaction_id = ?)
+					WHERE transaction_id = ? AND posted_transaction_id IS NULL
+					AND EXISTS (SELECT 1 FROM transactions p WHERE p.pending_transaction_id = ?)`,
+					now, t.TransactionId, t.TransactionId, t.TransactionId); err != nil {
+					return fmt.Errorf("failed to mark pending transaction '%s' as posted: %w", t.TransactionId, err)
+				}
+			}
+
+			if pendingID == nil {
+				continue
+			}
+
+			if _, err := tx.Exec(`UPDATE transactions SET posted_transaction_id = ?, posted_at = ?
+				WHERE transaction_id = ? AND (posted_transaction_id IS NULL OR posted_transaction_id != ?)`,
+				t.TransactionId, now, *pendingID, t.TransactionId); err != nil {
+				return fmt.Errorf("failed to mark pending transaction '%s' as posted: %w", *pendingID, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemoveTransactions marks transactions plaid has removed, so they are no longer exported
+func (s *Store) RemoveTransactions(ids []string) error {
+	now := s.now().UTC().Format(time.RFC3339)
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("UPDATE transactions SET removed = 1, updated = ? WHERE transaction_id = ?", now, id); err != nil {
+				return fmt.Errorf("failed to remove transaction '%s': %w", id, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemoveMissing marks transactions of an account dated between from and until inclusive as removed, unless their
+// ids are listed. ids must be every transaction plaid returned for the account over the same dates.
+func (s *Store) RemoveMissing(accountID string, from, until time.Time, ids []string) error {
+	returned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		returned[id] = true
+	}
+
+	rows, err := s.db.Query(`SELECT transaction_id FROM transactions WHERE account_id = ? AND date >= ? AND date <= ? AND removed = 0`,
+		accountID, from.Format(dateFormat), until.Format(dateFormat))
+	if err != nil {
+		return fmt.Errorf("failed to read transactions of account '%s': %w", accountID, err)
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to read transactions of account '%s': %w", accountID, err)
+		}
+
+		if !returned[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read transactions of account '%s': %w", accountID, err)
+	}
+
+	rows.Close()
+	return s.RemoveTransactions(missing)
+}
+
+// PendingChange is a pending transaction which has since posted, or been removed without posting
+type PendingChange struct {
+	Pending plaid.Transaction
+	// Posted is nil if the pending transaction was removed without posting
+	Posted *plaid.Transaction
+}
+
+// PendingChanges returns the pending transactions of an account which have posted or been removed
+// since they were last reported, sorted by date
+func (s *Store) PendingChanges(accountID string) ([]PendingChange, error) {
+	rows, err := s.db.Query(`SELECT p.data, t.data FROM transactions p
+		LEFT JOIN transactions t ON t.transaction_id = p.posted_transaction_id
+		WHERE p.account_id = ? AND p.pending = 1 AND (p.posted_transaction_id IS NOT NULL OR p.removed = 1)
+		AND p.transaction_id NOT IN (SELECT transaction_id FROM pending_reports)
+		ORDER BY p.date, p.transaction_id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending transactions of account '%s': %w", accountID, err)
+	}
+	defer rows.Close()
+
+	var changes []PendingChange
+	for rows.Next() {
+		var pendingData string
+		var postedData sql.NullString
+		if err := rows.Scan(&pendingData, &postedData); err != nil {
+			return nil, fmt.Errorf("failed to read pending transactions of account '%s': %w", accountID, err)
+		}
+
+		var change PendingChange
+		if err := json.Unmarshal([]byte(pendingData), &change.Pending); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal pending transaction of account '%s': %w", accountID, err)
+		}
+
+		if postedData.Valid {
+			change.Posted = &plaid.Transaction{}
+			if err := json.Unmarshal([]byte(postedData.String), change.Posted); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal posted transaction of account '%s': %w", accountID, err)
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// MarkReported stops pending transactions being returned by PendingChanges again
+func (s *Store) MarkReported(ids []string) error {
+	now := s.now().UTC().Format(time.RFC3339)
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO pending_reports (transaction_id, reported_at) VALUES (?, ?)", id, now); err != nil {
+				return fmt.Errorf("failed to mark pending transaction '%s' as reported: %w", id, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// PutObservations adds category observations, replacing any earlier observations with the same keys
+func (s *Store) PutObservations(observations []learned.Observation) error {
+	now := s.now().UTC().Format(time.RFC3339)
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, o := range observations {
+			if _, err := tx.Exec(`INSERT INTO category_observations (key, source, payee, category, amount_minor, currency, observed_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (key) DO UPDATE SET source = excluded.source, payee = excluded.payee,
+				category = excluded.category, amount_minor = excluded.amount_minor, currency = excluded.currency,
+				observed_at = excluded.observed_at`,
+				o.Key, o.Source, o.Payee, o.Category, o.Amount.Minor, o.Amount.Currency, now); err != nil {
+				return fmt.Errorf("failed to store category observation '%s': %w", o.Key, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Observations returns the category observations of a normalized payee
+func (s *Store) Observations(payee string) ([]learned.Observation, error) {
+	rows, err := s.db.Query(`SELECT key, source, payee, category, amount_minor, currency FROM category_observations
+		WHERE payee = ? ORDER BY key`, payee)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read category observations of payee '%s': %w", payee, err)
+	}
+	defer rows.Close()
+
+	var observations []learned.Observation
+	for rows.Next() {
+		var o learned.Observation
+		if err := rows.Scan(&o.Key, &o.Source, &o.Payee, &o.Category, &o.Amount.Minor, &o.Amount.Currency); err != nil {
+			return nil, fmt.Errorf("failed to read category observations of payee '%s': %w", payee, err)
+		}
+
+		observations = append(observations, o)
+	}
+
+	return observations, rows.Err()
+}
+
+// Accounts returns the accounts of an institution, sorted by name
+func (s *Store) Accounts(institution string) ([]plaid.AccountBase, error) {
+	rows, err := s.db.Query("SELECT data FROM accounts WHERE institution = ? ORDER BY name, account_id", institution)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accounts of institution '%s': %w", institution, err)
+	}
+	defer rows.Close()
+
+	var accounts []plaid.AccountBase
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read accounts of institution '%s': %w", institution, err)
+		}
+
+		var acct plaid.AccountBase
+		if err := json.Unmarshal([]byte(data), &acct); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal account of institution '%s': %w", institution, err)
+		}
+
+		accounts = append(accounts, acct)
+	}
+
+	return accounts, rows.Err()
+}
+
+// Transactions returns the transactions of an account dated between from and until inclusive, sorted by date.
+// Removed transactions, and pending transactions which have since posted, are left out.
+func (s *Store) Transactions(accountID string, from, until time.Time) ([]plaid.Transaction, error) {
+	rows, err := s.db.Query(`SELECT data FROM transactions WHERE account_id = ? AND date >= ? AND date <= ?
+		AND removed = 0 AND posted_transaction_id IS NULL ORDER BY date, first_seen, transaction_id`,
+		accountID, from.Format(dateFormat), until.Format(dateFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transactions of account '%s': %w", accountID, err)
+	}
+	defer rows.Close()
+
+	var transactions []plaid.Transaction
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read transactions of account '%s': %w", accountID, err)
+		}
+
+		var t plaid.Transaction
+		if err := json.Unmarshal([]byte(data), &t); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transaction of account '%s': %w", accountID, err)
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (s *Store) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction on transaction store '%s': %w", s.path, err)
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save transaction store '%s': %w", s.path, err)
+	}
+
+	return nil
+}
+
+func (s *Store) Close() error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("failed to close transaction store '%s': %w", s.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/learned"
+	"github.com/chill/plaidqif/internal/money"
+)
+
+func testStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testTransaction(id, date string, pending bool, pendingID string) plaid.Transaction {
+	tx := plaid.Transaction{
+		TransactionId: id,
+		AccountId:     "acct-1",
+		Name:          "Tesco",
+		Amount:        10.26,
+		Date:          date,
+		Pending:       pending,
+	}
+
+	if pendingID != "" {
+		tx.PendingTransactionId.Set(&pendingID)
+	}
+
+	return tx
+}
+
+func transactionIDs(t *testing.T, s *Store, from, until string) []string {
+	t.Helper()
+
+	fr, _ := time.Parse(dateFormat, from)
+	to, _ := time.Parse(dateFormat, until)
+	txs, err := s.Transactions("acct-1", fr, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, tx := range txs {
+		ids = append(ids, tx.TransactionId)
+	}
+
+	return ids
+}
+
+func TestStore_Transactions(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Batches [][]plaid.Transaction
+		Removed []string
+		Expect  []string
+	}{
+		{
+			Name: "DateRange",
+			Batches: [][]plaid.Transaction{{
+				testTransaction("tx-3", "2020-02-01", false, ""),
+				testTransaction("tx-2", "2020-01-05", false, ""),
+				testTransaction("tx-1", "2020-01-01", false, ""),
+				testTransaction("tx-0", "2019-12-31", false, ""),
+			}},
+			Expect: []string{"tx-1", "tx-2"},
+		},
+		{
+			Name: "Deduped",
+			Batches: [][]plaid.Transaction{
+				{testTransaction("tx-1", "2020-01-01", false, "")},
+				{testTransaction("tx-1", "2020-01-01", false, "")},
+			},
+			Expect: []string{"tx-1"},
+		},
+		{
+			Name: "PendingPosted",
+			Batches: [][]plaid.Transaction{
+				{testTransaction("pending-1", "2020-01-01", true, ""), testTransaction("pending-2", "2020-01-02", true, "")},
+				{testTransaction("tx-1", "2020-01-02", false, "pending-1")},
+			},
+			Expect: []string{"pending-2", "tx-1"},
+		},
+		{
+			Name: "PostedBeforePending",
+			Batches: [][]plaid.Transaction{
+				{testTransaction("tx-1", "2020-01-02", false, "pending-1")},
+				{testTransaction("pending-1", "2020-01-01", true, "")},
+			},
+			Expect: []string{"tx-1"},
+		},
+		{
+			Name: "Removed",
+			Batches: [][]plaid.Transaction{
+				{testTransaction("tx-1", "2020-01-01", false, ""), testTransaction("tx-2", "2020-01-02", false, "")},
+			},
+			Removed: []string{"tx-1"},
+			Expect:  []string{"tx-2"},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			s := testStore(t)
+			for _, batch := range tst.Batches {
+				if err := s.PutTransactions("monzo", batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.RemoveTransactions(tst.Removed); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := transactionIDs(t, s, "2020-01-01", "2020-01-31"); !reflect.DeepEqual(got, tst.Expect) {
+				t.Fatalf("mismatch in transactions\nhave: %v\nwant: %v", got, tst.Expect)
+			}
+		})
+	}
+}
+
+func TestStore_TransactionsRoundTrip(t *testing.T) {
+	s := testStore(t)
+
+	tx := testTransaction("tx-1", "2020-01-01", false, "")
+	payee := "Tesco Stores"
+	tx.PaymentMeta.Payee.Set(&payee)
+
+	if err := s.PutTransactions("monzo", []plaid.Transaction{tx}); err != nil {
+		t.Fatal(err)
+	}
+
+	date, _ := time.Parse(dateFormat, "2020-01-01")
+	got, err := s.Transactions("acct-1", date, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || got[0].TransactionId != "tx-1" || got[0].Amount != 10.26 || *got[0].PaymentMeta.Payee.Get() != payee {
+		t.Fatalf("mismatch in stored transaction: %+v", got)
+	}
+}
+
+func TestStore_Accounts(t *testing.T) {
+	s := testStore(t)
+
+	accounts := []plaid.AccountBase{
+		{AccountId: "acct-2", Name: "Savings", Type: plaid.ACCOUNTTYPE_DEPOSITORY},
+		{AccountId: "acct-1", Name: "Current", Type: plaid.ACCOUNTTYPE_DEPOSITORY},
+	}
+
+	if err := s.PutAccounts("monzo", accounts); err != nil {
+		t.Fatal(err)
+	}
+
+	// accounts are updated, not duplicated
+	accounts[0].Name = "Savings Pot"
+	if err := s.PutAccounts("monzo", accounts[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PutAccounts("amex", []plaid.AccountBase{{AccountId: "acct-3", Name: "Gold", Type: plaid.ACCOUNTTYPE_CREDIT}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Accounts("monzo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, acct := range got {
+		names = append(names, acct.AccountId+" "+acct.Name)
+	}
+
+	expect := []string{"acct-1 Current", "acct-2 Savings Pot"}
+	if !reflect.DeepEqual(names, expect) {
+		t.Fatalf("mismatch in accounts\nhave: %v\nwant: %v", names, expect)
+	}
+}
+
+func TestStore_PendingChanges(t *testing.T) {
+	s := testStore(t)
+
+	if err := s.PutTransactions("monzo", []plaid.Transaction{
+		testTransaction("pending-1", "2020-01-01", true, ""),
+		testTransaction("pending-2", "2020-01-02", true, ""),
+		testTransaction("pending-3", "2020-01-03", true, ""),
+		testTransaction("pending-4", "2020-01-04", true, ""),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	posted := testTransaction("tx-2", "2020-01-03", false, "pending-2")
+	posted.Amount = 12.5
+
+	// pending-1 posts, pending-2 posts for a different amount, pending-3 vanishes, and pending-4 is still pending
+	if err := s.PutTransactions("monzo", []plaid.Transaction{
+		testTransaction("tx-1", "2020-01-02", false, "pending-1"),
+		posted,
+		testTransaction("pending-4", "2020-01-04", true, ""),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fr, _ := time.Parse(dateFormat, "2020-01-01")
+	to, _ := time.Parse(dateFormat, "2020-01-31")
+	if err := s.RemoveMissing("acct-1", fr, to, []string{"tx-1", "tx-2", "pending-4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := s.PendingChanges("acct-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range changes {
+		change := c.Pending.TransactionId + " vanished"
+		if c.Posted != nil {
+			change = fmt.Sprintf("%s posted as %s for %.2f", c.Pending.TransactionId, c.Posted.TransactionId, c.Posted.Amount)
+		}
+
+		got = append(got, change)
+	}
+
+	expect := []string{"pending-1 posted as tx-1 for 10.26", "pending-2 posted as tx-2 for 12.50", "pending-3 vanished"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("mismatch in pending changes\nhave: %v\nwant: %v", got, expect)
+	}
+
+	if err := s.MarkReported([]string{"pending-1", "pending-2", "pending-3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = s.PendingChanges("acct-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 0 {
+		t.Fatalf("expected reported pending changes not to be returned again, got: %+v", changes)
+	}
+
+	if ids := transactionIDs(t, s, "2020-01-01", "2020-01-31"); !reflect.DeepEqual(ids, []string{"tx-1", "tx-2", "pending-4"}) {
+		t.Fatalf("mismatch in transactions after removing missing ones: %v", ids)
+	}
+}
+
+func TestStore_Observations(t *testing.T) {
+	s := testStore(t)
+
+	if err := s.PutObservations([]learned.Observation{
+		{Key: "tx-1", Source: learned.SourceRule, Payee: "tesco stores", Category: "Household", Amount: money.MustParse("10.50", "GBP")},
+		{Key: "tx-2", Source: learned.SourceRule, Payee: "tesco stores", Category: "Groceries", Amount: money.MustParse("20", "GBP")},
+		{Key: "tx-3", Source: learned.SourceRule, Payee: "amazon", Category: "Shopping", Amount: money.MustParse("5", "GBP")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// observing tx-1 again corrects its category
+	if err := s.PutObservations([]learned.Observation{
+		{Key: "tx-1", Source: learned.SourceQIF, Payee: "tesco stores", Category: "Groceries", Amount: money.MustParse("10.50", "GBP")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Observations("tesco stores")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []learned.Observation{
+		{Key: "tx-1", Source: learned.SourceQIF, Payee: "tesco stores", Category: "Groceries", Amount: money.MustParse("10.50", "GBP")},
+		{Key: "tx-2", Source: learned.SourceRule, Payee: "tesco stores", Category: "Groceries", Amount: money.MustParse("20", "GBP")},
+	}
+
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("mismatch in observations\nhave: %+v\nwant: %+v", got, expect)
+	}
+}
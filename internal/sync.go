@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/institutions"
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// syncChanges holds everything returned by plaid for an item since its last sync cursor
+type syncChanges struct {
+	added    []plaid.Transaction
+	modified []plaid.Transaction
+	removed  []plaid.RemovedTransaction
+	cursor   string
+}
+
+// syncStampFormat names the files of each sync after when it ran
+const syncStampFormat = "20060102-150405"
+
+// SyncTransactions downloads transactions added since the last sync of each institution into QIFs,
+// and reports transactions which were modified or removed since then, so they can be fixed by hand.
+// Each sync writes new files, named after when it ran, as they only hold the transactions added since the last one.
+func (p *PlaidQIF) SyncTransactions(institutionNames []string, opts OutputOptions) error {
+	opts.Format = FormatQIF
+	opts.stamp = time.Now().Format(syncStampFormat)
+	out, err := p.newExporter(opts, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	institutions, err := p.institutions.GetInstitutions(institutionNames)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Changed Transactions:")
+	fmt.Fprintln(tw, "Change\tInstitution\tAccount\tDate\tPayee\tAmount\tPlaid Transaction ID\t")
+	fmt.Fprintln(tw, "------\t-----------\t-------\t----\t-----\t------\t--------------------\t")
+
+	for _, ins := range institutions {
+		if err := p.syncInstitutionTransactions(tw, out, ins); err != nil {
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// flush changes before listing unmapped categories, so the tables don't interleave
+	tw.Flush()
+	p.printUnmappedCategories()
+	return nil
+}
+
+func (p *PlaidQIF) syncInstitutionTransactions(tw *tabwriter.Writer, out exporter, ins institutions.Institution) error {
+	ins, accounts, err := p.getInstitutionAccounts(ins)
+	if err != nil {
+		return err
+	}
+
+	if err := checkConsent(ins); err != nil {
+		return err
+	}
+
+	changes, err := p.getSyncChanges(ins)
+	if err != nil {
+		return fmt.Errorf("failed to sync transactions for institution '%s': %w", ins.Name, err)
+	}
+
+	if err := p.storeSyncChanges(ins.Name, changes); err != nil {
+		return err
+	}
+
+	added := groupByAccount(changes.added)
+	modified := groupByAccount(changes.modified)
+
+	for _, acct := range accounts {
+		if isInvestmentAccount(acct) {
+			// investment transactions aren't returned by sync, they can only be downloaded
+			continue
+		}
+
+		// sync only writes transactions added since the last sync, so transfers aren't matched
+		if err := p.appendTransactions(out, nil, ins.Name, acct, added[acct.AccountId]); err != nil {
+			return fmt.Errorf("failed to write transactions for account '%s' from institution '%s': %w", acct.Name, ins.Name, err)
+		}
+
+		for _, tx := range modified[acct.AccountId] {
+			amount, err := money.FromFloat32(-tx.Amount, currencyCode(tx.IsoCurrencyCode, tx.UnofficialCurrencyCode))
+			if err != nil {
+				return fmt.Errorf("failed to convert modified transaction '%s' amount: %w", tx.TransactionId, err)
+			}
+
+			fmt.Fprintln(tw, fmt.Sprintf("Modified\t%s\t%s\t%s\t%s\t%s\t%s\t",
+				ins.Name, acct.Name, tx.Date, tx.Name, amount, tx.TransactionId))
+		}
+	}
+
+	// plaid only tells us the id of removed transactions
+	for _, tx := range changes.removed {
+		fmt.Fprintln(tw, fmt.Sprintf("Removed\t%s\t\t\t\t\t%s\t", ins.Name, tx.GetTransactionId()))
+	}
+
+	// only move the cursor on once everything has been written, so a failed sync can be retried
+	if _, err := p.institutions.UpdateCursor(ins.Name, changes.cursor); err != nil {
+		return fmt.Errorf("failed to update sync cursor for existing institution '%s': %w", ins.Name, err)
+	}
+
+	return nil
+}
+
+func (p *PlaidQIF) storeSyncChanges(institution string, changes syncChanges) error {
+	if err := p.store.PutTransactions(institution, changes.added); err != nil {
+		return err
+	}
+
+	if err := p.store.PutTransactions(institution, changes.modified); err != nil {
+		return err
+	}
+
+	removed := make([]string, 0, len(changes.removed))
+	for _, tx := range changes.removed {
+		removed = append(removed, tx.GetTransactionId())
+	}
+
+	return p.store.RemoveTransactions(removed)
+}
+
+func (p *PlaidQIF) getSyncChanges(ins institutions.Institution) (syncChanges, error) {
+	changes := syncChanges{cursor: ins.Cursor}
+	count := int32(500)
+
+	for {
+		req := plaid.TransactionsSyncRequest{
+			AccessToken: ins.AccessToken,
+			Count:       &count,
+		}
+
+		// an empty cursor must be omitted entirely to sync from the beginning of history
+		if changes.cursor != "" {
+			cursor := changes.cursor
+			req.Cursor = &cursor
+		}
+
+		txSync := p.client.TransactionsSync(context.TODO())
+		txSync = txSync.TransactionsSyncRequest(req)
+
+		resp, _, err := txSync.Execute()
+		if err != nil {
+			// the cursor is not persisted until the sync completes, so if plaid reports a mutation
+			// during pagination, the whole sync can simply be rerun
+			return syncChanges{}, fmt.Errorf("failed to sync transactions from plaid: %w", err)
+		}
+
+		changes.added = append(changes.added, resp.Added...)
+		changes.modified = append(changes.modified, resp.Modified...)
+		changes.removed = append(changes.removed, resp.Removed...)
+		changes.cursor = resp.NextCursor
+
+		if !resp.HasMore {
+			return changes, nil
+		}
+	}
+}
+
+func groupByAccount(transactions []plaid.Transaction) map[string][]plaid.Transaction {
+	byAccount := make(map[string][]plaid.Transaction)
+	for _, tx := range transactions {
+		byAccount[tx.AccountId] = append(byAccount[tx.AccountId], tx)
+	}
+
+	for _, txs := range byAccount {
+		// plaid dates are ISO 8601, so sort lexically
+		sort.SliceStable(txs, func(i, j int) bool {
+			return txs[i].Date < txs[j].Date
+		})
+	}
+
+	return byAccount
+}
@@ -0,0 +1,107 @@
+package tabular
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// Record is a transaction with every field which can be exported as CSV or JSON Lines
+type Record struct {
+	TransactionID        string
+	PendingTransactionID string
+	AccountID            string
+	Institution          string
+	Account              string
+	Date                 time.Time
+	// AuthorizedDate is zero if the institution didn't say when the transaction was authorized
+	AuthorizedDate        time.Time
+	Payee                 string
+	Name                  string
+	Merchant              string
+	Category              string
+	PlaidCategory         string
+	PlaidDetailedCategory string
+	// Amount is positive when money enters the account, its currency is exported alongside it
+	Amount money.Amount
+	// OriginalAmount is the amount in the account's currency, if Amount was converted to a reporting currency
+	OriginalAmount money.Amount
+	Pending        bool
+	Memo           string
+	Number         string
+	Address        string
+	City           string
+	Region         string
+	PostalCode     string
+	Country        string
+}
+
+// Fields are the names of Record fields, for choosing CSV columns, in the order they are exported by default
+var Fields = []string{
+	"transaction_id", "pending_transaction_id", "account_id", "institution", "account", "date", "authorized_date",
+	"payee", "name", "merchant", "category", "plaid_category", "plaid_detailed_category", "amount", "outflow", "inflow",
+	"currency", "original_amount", "original_currency", "pending", "memo", "number", "address", "city", "region", "postal_code", "country",
+}
+
+// fieldFormatters format each field of a Record for CSV
+var fieldFormatters = map[string]func(r Record, dateFormat string) string{
+	"transaction_id":          func(r Record, _ string) string { return r.TransactionID },
+	"pending_transaction_id":  func(r Record, _ string) string { return r.PendingTransactionID },
+	"account_id":              func(r Record, _ string) string { return r.AccountID },
+	"institution":             func(r Record, _ string) string { return r.Institution },
+	"account":                 func(r Record, _ string) string { return r.Account },
+	"date":                    func(r Record, dateFormat string) string { return formatDate(r.Date, dateFormat) },
+	"authorized_date":         func(r Record, dateFormat string) string { return formatDate(r.AuthorizedDate, dateFormat) },
+	"payee":                   func(r Record, _ string) string { return r.Payee },
+	"name":                    func(r Record, _ string) string { return r.Name },
+	"merchant":                func(r Record, _ string) string { return r.Merchant },
+	"category":                func(r Record, _ string) string { return r.Category },
+	"plaid_category":          func(r Record, _ string) string { return r.PlaidCategory },
+	"plaid_detailed_category": func(r Record, _ string) string { return r.PlaidDetailedCategory },
+	"amount":                  func(r Record, _ string) string { return r.Amount.String() },
+	"outflow":                 func(r Record, _ string) string { return unsignedIf(r.Amount, -1) },
+	"inflow":                  func(r Record, _ string) string { return unsignedIf(r.Amount, 1) },
+	"currency":                func(r Record, _ string) string { return r.Amount.Currency },
+	"original_amount":         func(r Record, _ string) string { return formatOriginal(r.OriginalAmount) },
+	"original_currency":       func(r Record, _ string) string { return r.OriginalAmount.Currency },
+	"pending":                 func(r Record, _ string) string { return strconv.FormatBool(r.Pending) },
+	"memo":                    func(r Record, _ string) string { return r.Memo },
+	"number":                  func(r Record, _ string) string { return r.Number },
+	"address":                 func(r Record, _ string) string { return r.Address },
+	"city":                    func(r Record, _ string) string { return r.City },
+	"region":                  func(r Record, _ string) string { return r.Region },
+	"postal_code":             func(r Record, _ string) string { return r.PostalCode },
+	"country":                 func(r Record, _ string) string { return r.Country },
+}
+
+func formatDate(t time.Time, dateFormat string) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(dateFormat)
+}
+
+// formatOriginal returns nothing for an amount which wasn't converted
+func formatOriginal(a money.Amount) string {
+	if a == (money.Amount{}) {
+		return ""
+	}
+
+	return a.String()
+}
+
+// unsignedIf returns the unsigned amount if its sign is sign, or otherwise nothing,
+// for splitting amounts into inflow and outflow columns
+func unsignedIf(a money.Amount, sign int) string {
+	if a.Sign() != sign {
+		return ""
+	}
+
+	if sign < 0 {
+		a = a.Neg()
+	}
+
+	return a.String()
+}
@@ -0,0 +1,117 @@
+package tabular
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chill/plaidqif/internal/files"
+)
+
+// Column is a CSV column, holding the Record field named Field, one of Fields
+type Column struct {
+	Header string
+	Field  string
+}
+
+// Template chooses the columns of CSVs, either from a preset, or listed in Columns
+type Template struct {
+	// Preset is one of Presets
+	Preset string
+	// DateFormat overrides the date format of date columns
+	DateFormat string
+	Columns    []Column
+}
+
+// isoDate is understood by every app the presets are for
+const isoDate = "2006-01-02"
+
+// Presets are templates for the CSV importers of budgeting apps
+var Presets = map[string]Template{
+	"ynab": {
+		DateFormat: isoDate,
+		Columns: []Column{
+			{Header: "Date", Field: "date"},
+			{Header: "Payee", Field: "payee"},
+			{Header: "Memo", Field: "memo"},
+			{Header: "Outflow", Field: "outflow"},
+			{Header: "Inflow", Field: "inflow"},
+		},
+	},
+	"firefly": {
+		DateFormat: isoDate,
+		Columns: []Column{
+			{Header: "date", Field: "date"},
+			{Header: "description", Field: "payee"},
+			{Header: "amount", Field: "amount"},
+			{Header: "currency_code", Field: "currency"},
+			{Header: "category", Field: "category"},
+			{Header: "asset_account", Field: "account"},
+			{Header: "external_id", Field: "transaction_id"},
+			{Header: "notes", Field: "memo"},
+		},
+	},
+	"actual": {
+		DateFormat: isoDate,
+		Columns: []Column{
+			{Header: "Date", Field: "date"},
+			{Header: "Payee", Field: "payee"},
+			{Header: "Notes", Field: "memo"},
+			{Header: "Category", Field: "category"},
+			{Header: "Amount", Field: "amount"},
+		},
+	},
+}
+
+// LoadTemplate assumes confDir already exists. If there is no template file, the returned Template has a column
+// for every field, headed by the field's name.
+func LoadTemplate(confDir, filename string) (Template, error) {
+	if filename == "" {
+		filename = "csv.json"
+	}
+
+	path := filepath.Join(confDir, filename)
+
+	var t Template
+	err := files.Unmarshal(path, "csv template", &t)
+	if err != nil && !errors.Is(err, os.ErrNotExist) { // ignore ErrNotExist
+		return Template{}, err
+	}
+
+	return t.resolve()
+}
+
+// resolve returns the template with its preset or default columns filled in, erroring if it's invalid
+func (t Template) resolve() (Template, error) {
+	if t.Preset != "" {
+		if len(t.Columns) != 0 {
+			return Template{}, fmt.Errorf("csv template must have either a preset or columns, not both")
+		}
+
+		preset, ok := Presets[t.Preset]
+		if !ok {
+			return Template{}, fmt.Errorf("unknown csv template preset '%s'", t.Preset)
+		}
+
+		if t.DateFormat != "" {
+			preset.DateFormat = t.DateFormat
+		}
+
+		return preset, nil
+	}
+
+	if len(t.Columns) == 0 {
+		for _, f := range Fields {
+			t.Columns = append(t.Columns, Column{Header: f, Field: f})
+		}
+	}
+
+	for _, c := range t.Columns {
+		if _, ok := fieldFormatters[c.Field]; !ok {
+			return Template{}, fmt.Errorf("unknown field '%s' for csv column '%s'", c.Field, c.Header)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,91 @@
+package tabular
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadTemplate(t *testing.T) {
+	tmpl, err := LoadTemplate("./", "test_csv.json")
+	if err != nil {
+		t.Fatalf("failed to load csv template: %v", err)
+	}
+
+	expect := Template{
+		DateFormat: "2006-01-02",
+		Columns: []Column{
+			{Header: "When", Field: "date"},
+			{Header: "Who", Field: "payee"},
+			{Header: "How Much", Field: "amount"},
+		},
+	}
+
+	if !reflect.DeepEqual(tmpl, expect) {
+		t.Fatalf("mismatch in csv template\nhave: %+v\nwant: %+v", tmpl, expect)
+	}
+}
+
+func TestLoadTemplate_NoFile(t *testing.T) {
+	tmpl, err := LoadTemplate("./", "does_not_exist.json")
+	if err != nil {
+		t.Fatalf("failed to load csv template: %v", err)
+	}
+
+	if len(tmpl.Columns) != len(Fields) {
+		t.Fatalf("expected a column for each of %d fields, got %d", len(Fields), len(tmpl.Columns))
+	}
+}
+
+func TestTemplate_Resolve(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Template Template
+		Expect   Template
+		Err      string
+	}{
+		{
+			Name:     "Preset",
+			Template: Template{Preset: "actual"},
+			Expect:   Presets["actual"],
+		},
+		{
+			Name:     "PresetDateFormat",
+			Template: Template{Preset: "ynab", DateFormat: "01/02/2006"},
+			Expect:   Template{DateFormat: "01/02/2006", Columns: Presets["ynab"].Columns},
+		},
+		{
+			Name:     "UnknownPreset",
+			Template: Template{Preset: "mint"},
+			Err:      "unknown csv template preset 'mint'",
+		},
+		{
+			Name:     "PresetAndColumns",
+			Template: Template{Preset: "ynab", Columns: []Column{{Header: "Date", Field: "date"}}},
+			Err:      "csv template must have either a preset or columns, not both",
+		},
+		{
+			Name:     "UnknownField",
+			Template: Template{Columns: []Column{{Header: "Balance", Field: "balance"}}},
+			Err:      "unknown field 'balance' for csv column 'Balance'",
+		},
+	}
+
+	for _, tst := range tests {
+		got, err := tst.Template.resolve()
+		if tst.Err != "" {
+			if err == nil || err.Error() != tst.Err {
+				t.Fatalf("%s: expected error '%s', got: %v", tst.Name, tst.Err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", tst.Name, err)
+		}
+
+		if !reflect.DeepEqual(got, tst.Expect) {
+			t.Fatalf("%s: mismatch in csv template\nhave: %+v\nwant: %+v", tst.Name, got, tst.Expect)
+		}
+	}
+}
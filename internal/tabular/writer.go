@@ -0,0 +1,162 @@
+package tabular
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CSVWriter is not safe for concurrent use
+type CSVWriter struct {
+	w           *csv.Writer
+	template    Template
+	dateFormat  string
+	wroteHeader bool
+	err         error
+}
+
+// NewCSVWriter returns a CSVWriter which is not safe for concurrent use. The template's date format,
+// if it has one, overrides dateFormat.
+func NewCSVWriter(w io.Writer, template Template, dateFormat string) *CSVWriter {
+	if template.DateFormat != "" {
+		dateFormat = template.DateFormat
+	}
+
+	return &CSVWriter{
+		w:          csv.NewWriter(w),
+		template:   template,
+		dateFormat: dateFormat,
+	}
+}
+
+// WriteRecords writes a row for each record, preceded by the header row if nothing has been written yet
+func (w *CSVWriter) WriteRecords(records []Record) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if !w.wroteHeader {
+		header := make([]string, 0, len(w.template.Columns))
+		for _, c := range w.template.Columns {
+			header = append(header, c.Header)
+		}
+
+		if err := w.w.Write(header); err != nil {
+			w.err = err
+			return err
+		}
+
+		w.wroteHeader = true
+	}
+
+	for _, r := range records {
+		row := make([]string, 0, len(w.template.Columns))
+		for _, c := range w.template.Columns {
+			format, ok := fieldFormatters[c.Field]
+			if !ok {
+				w.err = fmt.Errorf("unknown field '%s' for csv column '%s'", c.Field, c.Header)
+				return w.err
+			}
+
+			row = append(row, format(r, w.dateFormat))
+		}
+
+		if err := w.w.Write(row); err != nil {
+			w.err = err
+			return err
+		}
+	}
+
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		w.err = err
+		return err
+	}
+
+	return nil
+}
+
+// jsonRecord is a Record as written to JSON Lines, with dates in ISO 8601 and exact decimal amounts
+type jsonRecord struct {
+	TransactionID         string `json:"transaction_id"`
+	PendingTransactionID  string `json:"pending_transaction_id,omitempty"`
+	AccountID             string `json:"account_id"`
+	Institution           string `json:"institution"`
+	Account               string `json:"account"`
+	Date                  string `json:"date"`
+	AuthorizedDate        string `json:"authorized_date,omitempty"`
+	Payee                 string `json:"payee"`
+	Name                  string `json:"name"`
+	Merchant              string `json:"merchant,omitempty"`
+	Category              string `json:"category,omitempty"`
+	PlaidCategory         string `json:"plaid_category,omitempty"`
+	PlaidDetailedCategory string `json:"plaid_detailed_category,omitempty"`
+	Amount                string `json:"amount"`
+	Currency              string `json:"currency"`
+	OriginalAmount        string `json:"original_amount,omitempty"`
+	OriginalCurrency      string `json:"original_currency,omitempty"`
+	Pending               bool   `json:"pending"`
+	Memo                  string `json:"memo,omitempty"`
+	Number                string `json:"number,omitempty"`
+	Address               string `json:"address,omitempty"`
+	City                  string `json:"city,omitempty"`
+	Region                string `json:"region,omitempty"`
+	PostalCode            string `json:"postal_code,omitempty"`
+	Country               string `json:"country,omitempty"`
+}
+
+// JSONLWriter writes every field of each record as a JSON object on its own line.
+// JSONLWriter is not safe for concurrent use.
+type JSONLWriter struct {
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONLWriter returns a JSONLWriter which is not safe for concurrent use
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &JSONLWriter{enc: enc}
+}
+
+func (w *JSONLWriter) WriteRecords(records []Record) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	for _, r := range records {
+		if err := w.enc.Encode(jsonRecord{
+			TransactionID:         r.TransactionID,
+			PendingTransactionID:  r.PendingTransactionID,
+			AccountID:             r.AccountID,
+			Institution:           r.Institution,
+			Account:               r.Account,
+			Date:                  formatDate(r.Date, isoDate),
+			AuthorizedDate:        formatDate(r.AuthorizedDate, isoDate),
+			Payee:                 r.Payee,
+			Name:                  r.Name,
+			Merchant:              r.Merchant,
+			Category:              r.Category,
+			PlaidCategory:         r.PlaidCategory,
+			PlaidDetailedCategory: r.PlaidDetailedCategory,
+			Amount:                r.Amount.String(),
+			Currency:              r.Amount.Currency,
+			OriginalAmount:        formatOriginal(r.OriginalAmount),
+			OriginalCurrency:      r.OriginalAmount.Currency,
+			Pending:               r.Pending,
+			Memo:                  r.Memo,
+			Number:                r.Number,
+			Address:               r.Address,
+			City:                  r.City,
+			Region:                r.Region,
+			PostalCode:            r.PostalCode,
+			Country:               r.Country,
+		}); err != nil {
+			w.err = fmt.Errorf("failed to encode transaction '%s': %w", r.TransactionID, err)
+			return w.err
+		}
+	}
+
+	return nil
+}
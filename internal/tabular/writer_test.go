@@ -0,0 +1,139 @@
+package tabular
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func testRecords() []Record {
+	return []Record{
+		{
+			TransactionID:         "tx-1",
+			PendingTransactionID:  "tx-0",
+			AccountID:             "acct-1",
+			Institution:           "monzo",
+			Account:               "Current Account",
+			Date:                  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			AuthorizedDate:        time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Payee:                 "Tesco",
+			Name:                  "TESCO STORES 1234",
+			Merchant:              "Tesco",
+			Category:              "Groceries",
+			PlaidCategory:         "FOOD_AND_DRINK",
+			PlaidDetailedCategory: "FOOD_AND_DRINK_GROCERIES",
+			Amount:                money.MustParse("-10.26", "GBP"),
+			Memo:                  "milk, \"eggs\"",
+			Number:                "1042",
+			Address:               "1 High Street",
+			City:                  "London",
+			Region:                "Greater London",
+			PostalCode:            "N1 1AA",
+			Country:               "GB",
+		},
+		{
+			TransactionID: "tx-2",
+			AccountID:     "acct-1",
+			Institution:   "monzo",
+			Account:       "Current Account",
+			Date:          time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+			Payee:         "Employer",
+			Name:          "EMPLOYER LTD",
+			Amount:        money.MustParse("5001.67", "GBP"),
+			Pending:       true,
+		},
+		{
+			TransactionID:  "tx-3",
+			AccountID:      "acct-2",
+			Institution:    "monzo",
+			Account:        "Euro Account",
+			Date:           time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+			Payee:          "Carrefour",
+			Name:           "CARREFOUR",
+			Amount:         money.MustParse("-8.60", "GBP"),
+			OriginalAmount: money.MustParse("-10", "EUR"),
+		},
+	}
+}
+
+type recordWriter interface {
+	WriteRecords(records []Record) error
+}
+
+func TestWriteRecords(t *testing.T) {
+	tests := []struct {
+		Name      string
+		NewWriter func(w *bytes.Buffer) recordWriter
+	}{
+		{Name: "default.csv", NewWriter: func(w *bytes.Buffer) recordWriter {
+			tmpl, err := Template{}.resolve()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return NewCSVWriter(w, tmpl, "02/01/2006")
+		}},
+		{Name: "ynab.csv", NewWriter: func(w *bytes.Buffer) recordWriter {
+			tmpl, err := Template{Preset: "ynab"}.resolve()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return NewCSVWriter(w, tmpl, "02/01/2006")
+		}},
+		{Name: "transactions.jsonl", NewWriter: func(w *bytes.Buffer) recordWriter { return NewJSONLWriter(w) }},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := tst.NewWriter(&out)
+
+			// write in two batches, to check the csv header is only written once
+			records := testRecords()
+			if err := w.WriteRecords(records[:1]); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteRecords(records[1:]); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tst.Name)
+			if *updateGolden {
+				if err := os.WriteFile(path, out.Bytes(), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.String(); got != string(expect) {
+				t.Fatalf("expected:\n%s\n\ngot:\n%s", expect, got)
+			}
+		})
+	}
+}
+
+func TestFieldsHaveFormatters(t *testing.T) {
+	if len(Fields) != len(fieldFormatters) {
+		t.Fatalf("expected %d field formatters, got %d", len(Fields), len(fieldFormatters))
+	}
+
+	for _, f := range Fields {
+		if _, ok := fieldFormatters[f]; !ok {
+			t.Fatalf("no formatter for field '%s'", f)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/files"
+	"github.com/chill/plaidqif/internal/tabular"
+)
+
+type recordWriter interface {
+	WriteRecords(records []tabular.Record) error
+}
+
+type tabularFile struct {
+	path string
+	f    *os.File
+	w    recordWriter
+}
+
+// tabularFiles writes transactions as CSV or JSON Lines, opening files for accounts as they are needed.
+// tabularFiles is not safe for concurrent use.
+type tabularFiles struct {
+	opts       OutputOptions
+	template   tabular.Template
+	dateFormat string
+	files      map[string]*tabularFile
+	order      []string
+}
+
+func newTabularFiles(opts OutputOptions, template tabular.Template, dateFormat string) (*tabularFiles, error) {
+	opts, err := validateOutputOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tabularFiles{
+		opts:       opts,
+		template:   template,
+		dateFormat: dateFormat,
+		files:      make(map[string]*tabularFile),
+	}, nil
+}
+
+func (t *tabularFiles) destination(institution string, acct plaid.AccountBase) string {
+	path, _ := outputPath(t.opts, institution, acct, t.opts.Format)
+	return path
+}
+
+func (t *tabularFiles) writeTransactions(institution string, acct plaid.AccountBase, transactions []transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	tf, err := t.file(institution, acct)
+	if err != nil {
+		return err
+	}
+
+	records := make([]tabular.Record, 0, len(transactions))
+	for _, tx := range transactions {
+		r, err := transactionRecord(institution, acct, tx)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, r)
+	}
+
+	if err := tf.w.WriteRecords(records); err != nil {
+		return fmt.Errorf("failed to write transactions to %s writer: %w", t.opts.Format, err)
+	}
+
+	return nil
+}
+
+func (t *tabularFiles) file(institution string, acct plaid.AccountBase) (*tabularFile, error) {
+	path, _ := outputPath(t.opts, institution, acct, t.opts.Format)
+	if tf, ok := t.files[path]; ok {
+		return tf, nil
+	}
+
+	f, err := files.OpenWriter(path, t.opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &tabularFile{path: path, f: f}
+	if t.opts.Format == FormatCSV {
+		tf.w = tabular.NewCSVWriter(f, t.template, t.dateFormat)
+	} else {
+		tf.w = tabular.NewJSONLWriter(f)
+	}
+
+	t.files[path] = tf
+	t.order = append(t.order, path)
+	return tf, nil
+}
+
+func transactionRecord(institution string, acct plaid.AccountBase, tx transaction) (tabular.Record, error) {
+	src := tx.source
+	r := tabular.Record{
+		TransactionID:        src.TransactionId,
+		PendingTransactionID: nullableString(src.PendingTransactionId),
+		AccountID:            acct.AccountId,
+		Institution:          institution,
+		Account:              acct.Name,
+		Date:                 tx.Date,
+		Payee:                tx.Payee,
+		Name:                 src.Name,
+		Merchant:             nullableString(src.MerchantName),
+		Category:             tx.Category,
+		// plaid amounts are positive when money leaves the account
+		Amount:     tx.Amount.Neg(),
+		Pending:    src.Pending,
+		Memo:       tx.Memo,
+		Number:     tx.Number,
+		Address:    nullableString(src.Location.Address),
+		City:       nullableString(src.Location.City),
+		Region:     nullableString(src.Location.Region),
+		PostalCode: nullableString(src.Location.PostalCode),
+		Country:    nullableString(src.Location.Country),
+	}
+
+	if tx.original != tx.Amount {
+		r.OriginalAmount = tx.original.Neg()
+	}
+
+	if pfc := src.PersonalFinanceCategory.Get(); pfc != nil {
+		r.PlaidCategory, r.PlaidDetailedCategory = pfc.Primary, pfc.Detailed
+	}
+
+	if authorized := nullableString(src.AuthorizedDate); authorized != "" {
+		var err error
+		r.AuthorizedDate, err = time.Parse(plaidDateFormat, authorized)
+		if err != nil {
+			return tabular.Record{}, fmt.Errorf("failed to parse authorized date for payee '%s' with date string '%s': %w", tx.Payee, authorized, err)
+		}
+	}
+
+	return r, nil
+}
+
+// Close closes every file opened, returning the first error encountered
+func (t *tabularFiles) Close() error {
+	var firstErr error
+	for _, path := range t.order {
+		tf := t.files[path]
+		if err := tf.f.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close %s file '%s': %w", t.opts.Format, tf.path, err)
+		}
+	}
+
+	t.files = make(map[string]*tabularFile)
+	t.order = nil
+	return firstErr
+}
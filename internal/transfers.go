@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+
+	"github.com/chill/plaidqif/internal/money"
+)
+
+// accountTransactions are the plaid transactions of one account, written along with those of other accounts
+// so that transfers between them can be matched
+type accountTransactions struct {
+	institution  string
+	acct         plaid.AccountBase
+	transactions []plaid.Transaction
+}
+
+// transferAccount is the account on the other side of a transfer
+type transferAccount struct {
+	institution string
+	acct        plaid.AccountBase
+}
+
+// transferSide is one side of a possible transfer
+type transferSide struct {
+	account transferAccount
+	tx      plaid.Transaction
+	date    time.Time
+	amount  money.Amount
+}
+
+// transferMatcher holds transactions matched as transfers between accounts, and those which look like transfers
+// but have no match. A nil transferMatcher matches nothing.
+type transferMatcher struct {
+	// matches maps the plaid transaction id of each side of a matched transfer to the other side
+	matches   map[string]transferSide
+	unmatched []transferSide
+}
+
+// matchTransfers matches settled transactions of equal and opposite amounts in different accounts, dated at most
+// days apart, when plaid categorised at least one of them as a transfer. Each transaction is matched at most once,
+// closest dates first.
+func matchTransfers(accounts []accountTransactions, days int) (*transferMatcher, error) {
+	// sides are grouped by currency and size of amount, as only those can match
+	groups := make(map[money.Amount][]transferSide)
+	var transferLike []transferSide
+	for _, a := range accounts {
+		for _, tx := range a.transactions {
+			if tx.Pending || tx.Amount == 0 {
+				continue
+			}
+
+			date, err := time.Parse(plaidDateFormat, tx.Date)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse transaction '%s' date '%s': %w", tx.TransactionId, tx.Date, err)
+			}
+
+			amount, err := money.FromFloat32(tx.Amount, currencyCode(tx.IsoCurrencyCode, tx.UnofficialCurrencyCode))
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert transaction '%s' amount: %w", tx.TransactionId, err)
+			}
+
+			side := transferSide{account: transferAccount{institution: a.institution, acct: a.acct}, tx: tx, date: date, amount: amount}
+			key := amount
+			if key.Sign() < 0 {
+				key = key.Neg()
+			}
+
+			groups[key] = append(groups[key], side)
+			if isTransferLike(tx) {
+				transferLike = append(transferLike, side)
+			}
+		}
+	}
+
+	type pair struct {
+		out, in transferSide
+		apart   time.Duration
+	}
+
+	var pairs []pair
+	for _, sides := range groups {
+		for _, out := range sides {
+			// pairs are found from the side money leaves, which plaid gives positive amounts
+			if out.amount.Sign() < 0 {
+				continue
+			}
+
+			for _, in := range sides {
+				if in.amount.Sign() > 0 || in.tx.AccountId == out.tx.AccountId {
+					continue
+				}
+
+				// equal and opposite amounts are common, such as a purchase and an unrelated refund
+				if !isTransferLike(out.tx) && !isTransferLike(in.tx) {
+					continue
+				}
+
+				apart := out.date.Sub(in.date)
+				if apart < 0 {
+					apart = -apart
+				}
+
+				if apart <= time.Duration(days)*24*time.Hour {
+					pairs = append(pairs, pair{out: out, in: in, apart: apart})
+				}
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].apart != pairs[j].apart {
+			return pairs[i].apart < pairs[j].apart
+		}
+
+		if pairs[i].out.tx.TransactionId != pairs[j].out.tx.TransactionId {
+			return pairs[i].out.tx.TransactionId < pairs[j].out.tx.TransactionId
+		}
+
+		return pairs[i].in.tx.TransactionId < pairs[j].in.tx.TransactionId
+	})
+
+	m := &transferMatcher{matches: make(map[string]transferSide)}
+	for _, p := range pairs {
+		_, outMatched := m.matches[p.out.tx.TransactionId]
+		_, inMatched := m.matches[p.in.tx.TransactionId]
+		if outMatched || inMatched {
+			continue
+		}
+
+		m.matches[p.out.tx.TransactionId] = p.in
+		m.matches[p.in.tx.TransactionId] = p.out
+	}
+
+	for _, side := range transferLike {
+		if _, ok := m.matches[side.tx.TransactionId]; !ok {
+			m.unmatched = append(m.unmatched, side)
+		}
+	}
+
+	sort.SliceStable(m.unmatched, func(i, j int) bool {
+		return m.unmatched[i].date.Before(m.unmatched[j].date)
+	})
+
+	return m, nil
+}
+
+// isTransferLike returns true if plaid categorised a transaction as a transfer or credit card payment
+func isTransferLike(tx plaid.Transaction) bool {
+	pfc := tx.PersonalFinanceCategory.Get()
+	if pfc == nil {
+		return false
+	}
+
+	return pfc.Primary == "TRANSFER_IN" || pfc.Primary == "TRANSFER_OUT" || pfc.Detailed == "LOAN_PAYMENTS_CREDIT_CARD_PAYMENT"
+}
+
+// match returns the account on the other side of a transaction, if it was matched as a transfer
+func (m *transferMatcher) match(transactionID string) (transferAccount, bool) {
+	if m == nil {
+		return transferAccount{}, false
+	}
+
+	other, ok := m.matches[transactionID]
+	return other.account, ok
+}
+
+// unmatchExported unmatches transfers with either side written out by an earlier run, as that side is skipped.
+// The other side is then written as an ordinary transaction, rather than being dropped in favour of the skipped
+// side, or moving the money a second time.
+func (m *transferMatcher) unmatchExported(exported func(institution, transactionID string) bool) {
+	if m == nil {
+		return
+	}
+
+	for id, other := range m.matches {
+		if exported(other.account.institution, other.tx.TransactionId) {
+			delete(m.matches, id)
+			delete(m.matches, other.tx.TransactionId)
+		}
+	}
+}
+
+// printUnmatched lists transactions which look like transfers, but have no match, so they can be reviewed
+func (m *transferMatcher) printUnmatched() {
+	if m == nil || len(m.unmatched) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, '\t', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "Unmatched Transfers:")
+	fmt.Fprintln(tw, "Institution\tAccount\tDate\tPayee\tAmount\tPlaid Transaction ID\t")
+	fmt.Fprintln(tw, "-----------\t-------\t----\t-----\t------\t--------------------\t")
+
+	for _, side := range m.unmatched {
+		// amounts are shown positive when money enters the account
+		fmt.Fprintln(tw, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t", side.account.institution, side.account.acct.Name,
+			side.tx.Date, side.tx.Name, side.amount.Neg(), side.tx.TransactionId))
+	}
+}
+
+// writeAccounts writes the transactions of every account, writing those matched between accounts as transfers
+// unless opts.TransferDays is negative. It returns the transfers matched, so unmatched ones can be listed once done,
+// and the error writing each account, if any.
+func (p *PlaidQIF) writeAccounts(out exporter, accounts []accountTransactions, opts OutputOptions) (*transferMatcher, []error, error) {
+	var transfers *transferMatcher
+	if opts.TransferDays >= 0 {
+		var err error
+		if transfers, err = matchTransfers(accounts, opts.TransferDays); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if !opts.IncludeExported {
+		transfers.unmatchExported(func(institution, transactionID string) bool {
+			_, ok := p.institutions.ExportedTo(institution, transactionID)
+			return ok
+		})
+	}
+
+	// one account failing to be written doesn't stop the rest
+	errs := make([]error, len(accounts))
+	for i, a := range accounts {
+		if err := p.appendTransactions(out, transfers, a.institution, a.acct, a.transactions); err != nil {
+			errs[i] = fmt.Errorf("failed to write transactions for account '%s' from institution '%s': %w", a.acct.Name, a.institution, err)
+		}
+	}
+
+	return transfers, errs, nil
+}
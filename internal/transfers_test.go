@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+func testTransfer(id, accountID, date string, amount float32, primary string) plaid.Transaction {
+	gbp := "GBP"
+	tx := plaid.Transaction{TransactionId: id, AccountId: accountID, Name: id, Date: date, Amount: amount}
+	tx.IsoCurrencyCode.Set(&gbp)
+	if primary != "" {
+		tx.PersonalFinanceCategory.Set(&plaid.PersonalFinanceCategory{Primary: primary, Detailed: primary + "_OTHER"})
+	}
+
+	return tx
+}
+
+func testTransferAccounts(txs ...plaid.Transaction) []accountTransactions {
+	byAccount := make(map[string][]plaid.Transaction)
+	var order []string
+	for _, tx := range txs {
+		if _, ok := byAccount[tx.AccountId]; !ok {
+			order = append(order, tx.AccountId)
+		}
+
+		byAccount[tx.AccountId] = append(byAccount[tx.AccountId], tx)
+	}
+
+	accounts := make([]accountTransactions, 0, len(order))
+	for _, id := range order {
+		accounts = append(accounts, accountTransactions{
+			institution:  "bank",
+			acct:         plaid.AccountBase{AccountId: id, Name: id},
+			transactions: byAccount[id],
+		})
+	}
+
+	return accounts
+}
+
+func TestMatchTransfers(t *testing.T) {
+	pending := testTransfer("in", "savings", "2020-01-02", -100, "TRANSFER_IN")
+	pending.Pending = true
+
+	tests := []struct {
+		Name         string
+		Transactions []plaid.Transaction
+		Days         int
+		// Matches maps each matched transaction to the account on the other side
+		Matches   map[string]string
+		Unmatched []string
+	}{
+		{
+			Name: "Match",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("in", "savings", "2020-01-02", -100, "TRANSFER_IN"),
+			},
+			Days:    3,
+			Matches: map[string]string{"out": "savings", "in": "current"},
+		},
+		{
+			Name: "OneSideTransferLike",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("in", "savings", "2020-01-02", -100, ""),
+			},
+			Days:    3,
+			Matches: map[string]string{"out": "savings", "in": "current"},
+		},
+		{
+			Name: "NeitherSideTransferLike",
+			Transactions: []plaid.Transaction{
+				testTransfer("purchase", "card", "2020-01-02", 10, "GENERAL_MERCHANDISE"),
+				testTransfer("refund", "current", "2020-01-02", -10, "GENERAL_MERCHANDISE"),
+			},
+			Days: 3,
+		},
+		{
+			Name: "AtTolerance",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("in", "savings", "2020-01-05", -100, "TRANSFER_IN"),
+			},
+			Days:    3,
+			Matches: map[string]string{"out": "savings", "in": "current"},
+		},
+		{
+			Name: "BeyondTolerance",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("in", "savings", "2020-01-06", -100, "TRANSFER_IN"),
+			},
+			Days:      3,
+			Unmatched: []string{"out", "in"},
+		},
+		{
+			Name: "SameAccountExcluded",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("in", "current", "2020-01-02", -100, "TRANSFER_IN"),
+			},
+			Days:      3,
+			Unmatched: []string{"out", "in"},
+		},
+		{
+			Name: "ClosestDateWins",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-05", 100, "TRANSFER_OUT"),
+				testTransfer("in-far", "savings", "2020-01-02", -100, "TRANSFER_IN"),
+				testTransfer("in-near", "isa", "2020-01-04", -100, "TRANSFER_IN"),
+			},
+			Days:      3,
+			Matches:   map[string]string{"out": "isa", "in-near": "current"},
+			Unmatched: []string{"in-far"},
+		},
+		{
+			Name: "MatchedOnce",
+			Transactions: []plaid.Transaction{
+				testTransfer("out-1", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("out-2", "card", "2020-01-02", 100, "TRANSFER_OUT"),
+				testTransfer("in", "savings", "2020-01-02", -100, "TRANSFER_IN"),
+			},
+			Days:      3,
+			Matches:   map[string]string{"out-1": "savings", "in": "current"},
+			Unmatched: []string{"out-2"},
+		},
+		{
+			Name: "PendingIgnored",
+			Transactions: []plaid.Transaction{
+				testTransfer("out", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+				pending,
+			},
+			Days:      3,
+			Unmatched: []string{"out"},
+		},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			m, err := matchTransfers(testTransferAccounts(tst.Transactions...), tst.Days)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matches := make(map[string]string)
+			for _, tx := range tst.Transactions {
+				if other, ok := m.match(tx.TransactionId); ok {
+					matches[tx.TransactionId] = other.acct.Name
+				}
+			}
+
+			if len(matches) == 0 {
+				matches = nil
+			}
+
+			if !reflect.DeepEqual(matches, tst.Matches) {
+				t.Fatalf("mismatch in matched transfers\nhave: %v\nwant: %v", matches, tst.Matches)
+			}
+
+			var unmatched []string
+			for _, side := range m.unmatched {
+				unmatched = append(unmatched, side.tx.TransactionId)
+			}
+
+			sort.Strings(unmatched)
+			expect := append([]string(nil), tst.Unmatched...)
+			sort.Strings(expect)
+			if len(expect) == 0 {
+				expect = nil
+			}
+
+			if !reflect.DeepEqual(unmatched, expect) {
+				t.Fatalf("mismatch in unmatched transfers\nhave: %v\nwant: %v", unmatched, expect)
+			}
+		})
+	}
+}
+
+func TestTransferMatcher_UnmatchExported(t *testing.T) {
+	m, err := matchTransfers(testTransferAccounts(
+		testTransfer("out-1", "current", "2020-01-02", 100, "TRANSFER_OUT"),
+		testTransfer("in-1", "savings", "2020-01-02", -100, "TRANSFER_IN"),
+		testTransfer("out-2", "current", "2020-01-03", 50, "TRANSFER_OUT"),
+		testTransfer("in-2", "savings", "2020-01-03", -50, "TRANSFER_IN"),
+	), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the side money left by was written last run, as an ordinary transaction
+	m.unmatchExported(func(institution, transactionID string) bool {
+		return institution == "bank" && transactionID == "out-1"
+	})
+
+	for id, expect := range map[string]bool{"out-1": false, "in-1": false, "out-2": true, "in-2": true} {
+		if _, ok := m.match(id); ok != expect {
+			t.Fatalf("mismatch in whether '%s' is matched\nhave: %t\nwant: %t", id, ok, expect)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"time"
@@ -9,10 +10,17 @@ import (
 
 	"github.com/chill/plaidqif/internal"
 	"github.com/chill/plaidqif/internal/osutil"
+	"github.com/chill/plaidqif/internal/pendingmode"
 )
 
 const defaultDateFmt = "02/01/2006"
 
+// Exit codes. A download exits with exitPartialFailure when some but not all of it failed, having written the rest.
+const (
+	exitFailure        = 1
+	exitPartialFailure = 2
+)
+
 var (
 	root        = kingpin.New("plaidqif", "Downloads transactions from financial institutions using Plaid, and converts them to QIF files")
 	configDir   = root.Flag("confdir", "Directory where plaintext plaidqif configuration is stored").Default(filepath.Join(osutil.MustHomeDir(), ".plaidqif")).PlaceHolder("$HOME/.plaidqif").String()
@@ -35,13 +43,53 @@ var (
 	listInstitutions = root.Command("list-ins", "List institutions")
 
 	listAccounts            = root.Command("list-accounts", "List accounts from an institution")
+	listAccountsParallel    = listAccounts.Flag("parallel", "Number of institutions to get accounts from at once").Default("4").Int()
 	listAccountInstitutions = listAccounts.Arg("institutions", "Institution to list accounts from, defaults to all").Strings()
 
-	downloadTransactions = root.Command("download", "Download transactions into QIFs")
-	downloadUntil        = downloadTransactions.Flag("until", "Date to download transactions up to, inclusive, defaults to today").Default(time.Now().Format(defaultDateFmt)).String()
-	downloadOutDir       = downloadTransactions.Flag("outdir", "Directory to write QIFs into, defaults to current working dir").Default(osutil.MustWorkingDir()).PlaceHolder("<workdir>").ExistingDir()
-	downloadFrom         = downloadTransactions.Arg("from", "Date to download transactions from, inclusive").Required().String()
-	downloadInstitutions = downloadTransactions.Arg("institutions", "Institution(s) to download transactions from, for your configured accounts, defaults to all").Strings()
+	listLiabilities           = root.Command("liabilities", "List APR, minimum payment, next due date and outstanding principal of credit cards and loans")
+	listLiabilityInstitutions = listLiabilities.Arg("institutions", "Institution to list liabilities from, defaults to all").Strings()
+
+	downloadTransactions    = root.Command("download", "Download transactions into QIFs")
+	downloadUntil           = downloadTransactions.Flag("until", "Date to download transactions up to, inclusive, defaults to today").Default(time.Now().Format(defaultDateFmt)).String()
+	downloadOutDir          = downloadTransactions.Flag("outdir", "Directory to write QIFs into, defaults to current working dir").Default(osutil.MustWorkingDir()).PlaceHolder("<workdir>").ExistingDir()
+	downloadCombine         = downloadTransactions.Flag("combine", "Write accounts to one QIF per account, one per institution, or one for all of them").Default(internal.CombineNone).Enum(internal.CombineModes...)
+	downloadFormat          = downloadTransactions.Flag("format", "Format to write transactions in, QIF, OFX 1 (SGML), OFX 2 (XML), beancount, ledger, CSV, JSON Lines, camt.053, MT940, or straight into a GnuCash book, investment accounts are only written as QIF").Default(internal.FormatQIF).Enum(internal.Formats...)
+	downloadIncludeExported = downloadTransactions.Flag("include-exported", "Write transactions again which were already written by an earlier download, sync or export").Bool()
+	downloadTransferDays    = downloadTransactions.Flag("transfer-days", "Match equal and opposite transactions between accounts dated up to this many days apart as transfers, or -1 to not match them").Default("3").Int()
+	downloadPending         = downloadTransactions.Flag("pending", "Include, exclude, or write pending transactions to separate .pending files, for accounts without a mode in pending.json").Enum(pendingmode.Modes...)
+	downloadParallel        = downloadTransactions.Flag("parallel", "Number of institutions and accounts to download from at once").Default("4").Int()
+	downloadKeepGoing       = downloadTransactions.Flag("keep-going", "Try every institution and account, writing and saving whatever succeeds, and exit with 2 if only some failed").Bool()
+	downloadFrom            = downloadTransactions.Arg("from", "Date to download transactions from, inclusive").Required().String()
+	downloadInstitutions    = downloadTransactions.Arg("institutions", "Institution(s) to download transactions from, for your configured accounts, defaults to all").Strings()
+
+	exportTransactions    = root.Command("export", "Export transactions kept from previous downloads and syncs, without contacting Plaid")
+	exportUntil           = exportTransactions.Flag("until", "Date to export transactions up to, inclusive, defaults to today").Default(time.Now().Format(defaultDateFmt)).String()
+	exportOutDir          = exportTransactions.Flag("outdir", "Directory to write exports into, defaults to current working dir").Default(osutil.MustWorkingDir()).PlaceHolder("<workdir>").ExistingDir()
+	exportCombine         = exportTransactions.Flag("combine", "Write accounts to one file per account, one per institution, or one for all of them").Default(internal.CombineNone).Enum(internal.CombineModes...)
+	exportFormat          = exportTransactions.Flag("format", "Format to write transactions in, as for download").Default(internal.FormatQIF).Enum(internal.Formats...)
+	exportAccounts        = exportTransactions.Flag("account", "Account to export, repeat for more than one, defaults to all").Strings()
+	exportCache           = exportTransactions.Flag("cache", "Export from the Plaid responses cached by download, rather than the transaction store").Bool()
+	exportIncludeExported = exportTransactions.Flag("include-exported", "Write transactions again which were already written by an earlier download, sync or export, use --no-include-exported to skip them").Default("true").Bool()
+	exportTransferDays    = exportTransactions.Flag("transfer-days", "Match equal and opposite transactions between accounts dated up to this many days apart as transfers, or -1 to not match them").Default("3").Int()
+	exportPending         = exportTransactions.Flag("pending", "Include, exclude, or write pending transactions to separate .pending files, for accounts without a mode in pending.json").Enum(pendingmode.Modes...)
+	exportFrom            = exportTransactions.Arg("from", "Date to export transactions from, inclusive").Required().String()
+	exportInstitutions    = exportTransactions.Arg("institutions", "Institution(s) to export transactions from, defaults to all").Strings()
+
+	learnCategories = root.Command("learn", "Learn the categories given to payees in QIFs, such as ones corrected after importing them")
+	learnCurrency   = learnCategories.Flag("currency", "ISO 4217 currency of the amounts in the QIFs").Default("GBP").String()
+	learnFiles      = learnCategories.Arg("qifs", "QIF file(s) to learn categories from").Required().ExistingFiles()
+
+	rulesCmd              = root.Command("rules", "Work with payee rules")
+	rulesTest             = rulesCmd.Command("test", "Show which payee rules hit each stored transaction between two dates, without contacting Plaid")
+	rulesTestUntil        = rulesTest.Flag("until", "Date to test transactions up to, inclusive, defaults to today").Default(time.Now().Format(defaultDateFmt)).String()
+	rulesTestFrom         = rulesTest.Arg("from", "Date to test transactions from, inclusive").Required().String()
+	rulesTestInstitutions = rulesTest.Arg("institutions", "Institution(s) to test transactions from, defaults to all").Strings()
+
+	syncTransactions    = root.Command("sync", "Download transactions added since the last sync into QIFs, and report modified and removed transactions")
+	syncOutDir          = syncTransactions.Flag("outdir", "Directory to write QIFs into, defaults to current working dir").Default(osutil.MustWorkingDir()).PlaceHolder("<workdir>").ExistingDir()
+	syncCombine         = syncTransactions.Flag("combine", "Write accounts to one QIF per account, one per institution, or one for all of them").Default(internal.CombineNone).Enum(internal.CombineModes...)
+	syncIncludeExported = syncTransactions.Flag("include-exported", "Write transactions again which were already written by an earlier download, sync or export").Bool()
+	syncInstitutions    = syncTransactions.Arg("institutions", "Institution(s) to sync transactions from, for your configured accounts, defaults to all").Strings()
 )
 
 func main() {
@@ -71,20 +119,63 @@ func main() {
 	case listInstitutions.FullCommand():
 		err = pq.ListInstitutions()
 	case listAccounts.FullCommand():
-		err = pq.ListAccounts(*listAccountInstitutions)
+		err = pq.ListAccounts(*listAccountInstitutions, *listAccountsParallel)
+	case listLiabilities.FullCommand():
+		err = pq.ListLiabilities(*listLiabilityInstitutions)
 	case downloadTransactions.FullCommand():
-		err = pq.DownloadTransactions(*downloadInstitutions, *downloadFrom, *downloadUntil, *downloadOutDir)
+		err = pq.DownloadTransactions(*downloadInstitutions, *downloadFrom, *downloadUntil, *downloadParallel, *downloadKeepGoing, internal.OutputOptions{
+			OutDir:          *downloadOutDir,
+			Combine:         *downloadCombine,
+			Format:          *downloadFormat,
+			IncludeExported: *downloadIncludeExported,
+			Pending:         *downloadPending,
+			TransferDays:    *downloadTransferDays,
+		})
+	case exportTransactions.FullCommand():
+		err = pq.ExportTransactions(*exportInstitutions, *exportFrom, *exportUntil, *exportAccounts, *exportCache, internal.OutputOptions{
+			OutDir:          *exportOutDir,
+			Combine:         *exportCombine,
+			Format:          *exportFormat,
+			IncludeExported: *exportIncludeExported,
+			Pending:         *exportPending,
+			TransferDays:    *exportTransferDays,
+		})
+	case learnCategories.FullCommand():
+		err = pq.LearnCategories(*learnFiles, *learnCurrency)
+	case rulesTest.FullCommand():
+		err = pq.TestRules(*rulesTestInstitutions, *rulesTestFrom, *rulesTestUntil)
+	case syncTransactions.FullCommand():
+		err = pq.SyncTransactions(*syncInstitutions, internal.OutputOptions{
+			OutDir:          *syncOutDir,
+			Combine:         *syncCombine,
+			IncludeExported: *syncIncludeExported,
+		})
 	default:
 		kingpin.Fatalf("Unknown command ")
 	}
 
 	// if we haven't errored out yet, close pq, so that institutions get written to disk, updating err
-	// we don't defer the close, because we don't want to write the file if something goes wrong
-	if err == nil {
-		err = pq.Close()
+	// we don't defer the close, because we don't want to write the file if something goes wrong,
+	// unless a download failed having written whatever succeeded
+	var failures *internal.DownloadFailures
+	if err == nil || errors.As(err, &failures) {
+		if closeErr := pq.Close(); closeErr != nil {
+			err = closeErr
+		}
 	}
 
 	if err != nil {
-		kingpin.Fatalf("%v", err)
+		kingpin.Errorf("%v", err)
+		os.Exit(exitCode(err))
 	}
 }
+
+// exitCode returns the exit code of a command which failed with err
+func exitCode(err error) int {
+	var failures *internal.DownloadFailures
+	if errors.As(err, &failures) && failures.Partial() {
+		return exitPartialFailure
+	}
+
+	return exitFailure
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/chill/plaidqif/internal"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Err    error
+		Expect int
+	}{
+		{Name: "Failure", Err: errors.New("failed"), Expect: exitFailure},
+		{Name: "PartialFailure", Err: &internal.DownloadFailures{Failed: 1, Total: 3}, Expect: exitPartialFailure},
+		{Name: "WrappedPartialFailure", Err: fmt.Errorf("download: %w", &internal.DownloadFailures{Failed: 2, Total: 3}), Expect: exitPartialFailure},
+		{Name: "EverythingFailed", Err: &internal.DownloadFailures{Failed: 3, Total: 3}, Expect: exitFailure},
+	}
+
+	for _, tst := range tests {
+		tst := tst
+		t.Run(tst.Name, func(t *testing.T) {
+			if code := exitCode(tst.Err); code != tst.Expect {
+				t.Fatalf("mismatch in exit code\nhave: %d\nwant: %d", code, tst.Expect)
+			}
+		})
+	}
+}